@@ -0,0 +1,252 @@
+package mgm
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/uncle-gua/mgm/field"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditLogCollectionName is the name of the shared audit log collection.
+const AuditLogCollectionName = "audit_log"
+
+// Auditable interface is implemented by models whose changes are recorded in an audit
+// log. Creating, updating and deleting an auditable model writes an audit record in
+// the same session, so use a transaction to make them atomic.
+type Auditable interface {
+	// AuditCollectionName returns the name of the collection of the model's audit
+	// records, e.g AuditLogCollectionName. Return an empty string to use the
+	// `<collection>_history` collection.
+	AuditCollectionName() string
+}
+
+// AuditOp is the operation of an audit record.
+type AuditOp string
+
+// The operations of audit records.
+const (
+	AuditCreate AuditOp = "create"
+	AuditUpdate AuditOp = "update"
+	AuditDelete AuditOp = "delete"
+)
+
+// ActorResolver returns the actor (e.g the user) of a context, or an empty
+// string if the context has no actor.
+type ActorResolver func(ctx context.Context) string
+
+// AuditChange is the change of a field.
+type AuditChange struct {
+	// Field is the field's dotted bson path, e.g "profile.age".
+	Field string `json:"field" bson:"field"`
+	// Old is the stored value, nil for new fields.
+	Old interface{} `json:"old" bson:"old"`
+	// New is the new value, nil for removed fields.
+	New interface{} `json:"new" bson:"new"`
+}
+
+// AuditRecord is a change of a model.
+type AuditRecord struct {
+	IDField `bson:",inline"`
+
+	Collection string        `json:"collection" bson:"collection"`
+	DocumentID interface{}   `json:"document_id" bson:"document_id"`
+	Op         AuditOp       `json:"op" bson:"op"`
+	Actor      string        `json:"actor,omitempty" bson:"actor,omitempty"`
+	Timestamp  time.Time     `json:"timestamp" bson:"timestamp"`
+	Changes    []AuditChange `json:"changes" bson:"changes"`
+}
+
+type actorCtxKey struct{}
+
+// WithActor returns a copy of the context whose changes are made by the actor.
+// Audit records of auditable models contain the actor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorCtxKey{}, actor)
+}
+
+// ActorFromCtx returns the actor that is set on the context by WithActor.
+func ActorFromCtx(ctx context.Context) string {
+	actor, _ := ctx.Value(actorCtxKey{}).(string)
+	return actor
+}
+
+// History returns the audit records of the model, from the oldest to the newest.
+func History(ctx context.Context, model Model) ([]*AuditRecord, error) {
+	a, ok := model.(Auditable)
+	if !ok {
+		return nil, errors.New("model is not auditable")
+	}
+
+	coll := Coll(model)
+	records := make([]*AuditRecord, 0)
+
+	filter := bson.M{"collection": coll.Name(), "document_id": model.GetID()}
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}, {Key: field.ID, Value: 1}})
+
+	if err := coll.auditCollection(ctx, a).SimpleFindWithCtx(ctx, &records, filter, opts); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// auditCollection returns the collection of the model's audit records.
+func (coll *Collection) auditCollection(ctx context.Context, a Auditable) *Collection {
+	name := a.AuditCollectionName()
+	if name == "" {
+		name = coll.collection(ctx).Name() + "_history"
+	}
+
+	return coll.relatedCollection(ctx, name)
+}
+
+// relatedCollection returns the collection with the given name in the database
+// of the context's tenant, which uses the collection's session.
+func (coll *Collection) relatedCollection(ctx context.Context, name string) *Collection {
+	related := NewCollection(coll.collection(ctx).Database(), name)
+	related.session = coll.session
+
+	return related
+}
+
+// actor returns the actor of the context using the connection's resolver.
+func (coll *Collection) actor(ctx context.Context) string {
+	if coll.conn != nil && coll.conn.config.ActorResolver != nil {
+		return coll.conn.config.ActorResolver(ctx)
+	}
+
+	return ActorFromCtx(ctx)
+}
+
+// ErrNotRecorded is returned by the operations that can't record the changes of
+// auditable and revisioned models, e.g FindOneAndUpdate and Query.Delete.
+var ErrNotRecorded = errors.New("operation doesn't record the changes of auditable and revisioned models")
+
+// isRecorded returns true if the model's changes are recorded, i.e it's
+// auditable or revisioned.
+func isRecorded(model Model) bool {
+	_, auditable := model.(Auditable)
+	_, revisioned := model.(Revisioned)
+
+	return auditable || revisioned
+}
+
+// storedDocument returns the stored document of an auditable or revisioned model:
+// its snapshot, or the document that is read from the collection. It returns nil
+// for other models and for models whose document doesn't exist.
+func storedDocument(ctx context.Context, coll *Collection, model Model) (bson.Raw, error) {
+	if !isRecorded(model) {
+		return nil, nil
+	}
+
+	if s, ok := model.(Snapshotter); ok && s.Snapshot() != nil {
+		return s.Snapshot(), nil
+	}
+
+	return findDocument(ctx, coll, model, bson.M{field.ID: model.GetID()})
+}
+
+// findDocument returns the document of the model that matches the filter,
+// or nil if there is no such document.
+func findDocument(ctx context.Context, coll *Collection, model Model, filter interface{}) (bson.Raw, error) {
+	var doc bson.Raw
+	op := &OpInfo{Op: OpFirst, Filter: filter, Model: model, Options: []*options.FindOneOptions{}}
+
+	err := coll.intercept(ctx, op, func(ctx context.Context, op *OpInfo) (err error) {
+		opts, err := opOptions[*options.FindOneOptions](op)
+		if err != nil {
+			return err
+		}
+
+		doc, err = coll.collection(ctx).FindOne(ctx, op.Filter, opts...).DecodeBytes()
+		return err
+	})
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+
+	return doc, err
+}
+
+// audit writes the audit record of an auditable model's change. The before document
+// is the stored document, nil for created models. The after document is the new
+// document, nil for deleted models. Updates without changes are not recorded.
+func audit(ctx context.Context, coll *Collection, model Model, op AuditOp, before, after bson.Raw) error {
+	a, ok := model.(Auditable)
+	if !ok {
+		return nil
+	}
+
+	if before == nil {
+		before = emptyDocument
+	}
+	if after == nil {
+		after = emptyDocument
+	}
+
+	changes, err := auditChanges(before, after)
+	if err != nil {
+		return err
+	}
+
+	if op == AuditUpdate && len(changes) == 0 {
+		return nil
+	}
+
+	record := &AuditRecord{
+		Collection: coll.Name(),
+		DocumentID: model.GetID(),
+		Op:         op,
+		Actor:      coll.actor(ctx),
+		Timestamp:  time.Now().UTC(),
+		Changes:    changes,
+	}
+
+	return coll.auditCollection(ctx, a).CreateWithCtx(ctx, record)
+}
+
+// emptyDocument is an empty bson document.
+var emptyDocument = bson.Raw{5, 0, 0, 0, 0}
+
+// auditChanges returns the changes of the fields between the documents, sorted by their path.
+func auditChanges(before, after bson.Raw) ([]AuditChange, error) {
+	set, unset := bson.M{}, bson.M{}
+	diffDocuments("", before, after, set, unset)
+
+	changes := make([]AuditChange, 0, len(set)+len(unset))
+
+	for path, val := range set {
+		c := AuditChange{Field: path}
+		if err := val.(bson.RawValue).Unmarshal(&c.New); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+
+	for path := range unset {
+		changes = append(changes, AuditChange{Field: path})
+	}
+
+	for i, c := range changes {
+		old, err := before.LookupErr(strings.Split(c.Field, ".")...)
+		if err != nil {
+			continue
+		}
+		if err := old.Unmarshal(&changes[i].Old); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+
+	return changes, nil
+}
@@ -0,0 +1,282 @@
+package mgm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uncle-gua/mgm"
+	"github.com/uncle-gua/mgm/builder"
+	"github.com/uncle-gua/mgm/internal/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+type Wallet struct {
+	mgm.IDField `bson:",inline"`
+
+	Owner   string `bson:"owner"`
+	Balance int    `bson:"balance"`
+}
+
+func (w *Wallet) AuditCollectionName() string {
+	return ""
+}
+
+type Ledger struct {
+	mgm.IDField `bson:",inline"`
+
+	Total int `bson:"total"`
+}
+
+func (l *Ledger) AuditCollectionName() string {
+	return mgm.AuditLogCollectionName
+}
+
+// auditRecord returns the document of the audit record that is inserted by the started event.
+func auditRecord(t *testing.T, mt *mtest.T, coll string) bson.Raw {
+	evt := mt.GetStartedEvent()
+	require.Equal(t, "insert", evt.CommandName)
+	require.Equal(t, coll, evt.Command.Lookup("insert").StringValue())
+
+	return evt.Command.Lookup("documents").Array().Index(0).Value().Document()
+}
+
+func TestAuditCreate(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+
+		wallet := &Wallet{Owner: "Ali", Balance: 10}
+		ctx := mgm.WithActor(context.Background(), "admin")
+		util.AssertErrIsNil(t, mgm.Coll(wallet).CreateWithCtx(ctx, wallet))
+
+		mt.GetStartedEvent()
+		record := auditRecord(t, mt, "wallets_history")
+		require.Equal(t, "wallets", record.Lookup("collection").StringValue())
+		require.Equal(t, wallet.ID, record.Lookup("document_id").ObjectID())
+		require.Equal(t, "create", record.Lookup("op").StringValue())
+		require.Equal(t, "admin", record.Lookup("actor").StringValue())
+		require.Equal(t, bson.TypeDateTime, record.Lookup("timestamp").Type)
+
+		changes, err := record.Lookup("changes").Array().Values()
+		util.AssertErrIsNil(t, err)
+		require.Len(t, changes, 3)
+		require.Equal(t, "_id", changes[0].Document().Lookup("field").StringValue())
+		require.Equal(t, bson.TypeNull, changes[0].Document().Lookup("old").Type)
+		require.Equal(t, "balance", changes[1].Document().Lookup("field").StringValue())
+		require.Equal(t, int64(10), changes[1].Document().Lookup("new").AsInt64())
+	})
+}
+
+func TestAuditUpdate(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		wallet := &Wallet{Owner: "Ali", Balance: 20}
+		wallet.SetID(primitive.NewObjectID())
+
+		ns := "db." + mgm.Coll(wallet).Name()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: wallet.ID},
+				{Key: "owner", Value: "Ali"},
+				{Key: "balance", Value: 10},
+			}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateSuccessResponse(),
+		)
+
+		util.AssertErrIsNil(t, mgm.Coll(wallet).Update(wallet))
+
+		require.Equal(t, "find", mt.GetStartedEvent().CommandName)
+		require.Equal(t, "update", mt.GetStartedEvent().CommandName)
+
+		record := auditRecord(t, mt, "wallets_history")
+		require.Equal(t, "update", record.Lookup("op").StringValue())
+
+		changes, err := record.Lookup("changes").Array().Values()
+		util.AssertErrIsNil(t, err)
+		require.Len(t, changes, 1)
+		require.Equal(t, "balance", changes[0].Document().Lookup("field").StringValue())
+		require.Equal(t, int64(10), changes[0].Document().Lookup("old").AsInt64())
+		require.Equal(t, int64(20), changes[0].Document().Lookup("new").AsInt64())
+	})
+}
+
+func TestAuditDeleteInSharedLog(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		ledger := &Ledger{Total: 5}
+		ledger.SetID(primitive.NewObjectID())
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.ledgers", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: ledger.ID},
+				{Key: "total", Value: 5},
+			}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateSuccessResponse(),
+		)
+
+		util.AssertErrIsNil(t, mgm.Coll(ledger).Delete(ledger))
+
+		mt.GetStartedEvent()
+		require.Equal(t, "delete", mt.GetStartedEvent().CommandName)
+
+		record := auditRecord(t, mt, mgm.AuditLogCollectionName)
+		require.Equal(t, "ledgers", record.Lookup("collection").StringValue())
+		require.Equal(t, "delete", record.Lookup("op").StringValue())
+
+		changes, err := record.Lookup("changes").Array().Values()
+		util.AssertErrIsNil(t, err)
+		require.Len(t, changes, 2)
+		require.Equal(t, int64(5), changes[1].Document().Lookup("old").AsInt64())
+		require.Equal(t, bson.TypeNull, changes[1].Document().Lookup("new").Type)
+	})
+}
+
+func TestHistory(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		wallet := &Wallet{}
+		wallet.SetID(primitive.NewObjectID())
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.wallets_history", mtest.FirstBatch,
+			bson.D{{Key: "op", Value: "create"}, {Key: "actor", Value: "admin"}},
+			bson.D{{Key: "op", Value: "update"}, {Key: "changes", Value: bson.A{
+				bson.D{{Key: "field", Value: "balance"}, {Key: "old", Value: 10}, {Key: "new", Value: 20}},
+			}}},
+		))
+
+		records, err := mgm.History(context.Background(), wallet)
+		util.AssertErrIsNil(t, err)
+		require.Len(t, records, 2)
+		require.Equal(t, mgm.AuditCreate, records[0].Op)
+		require.Equal(t, "admin", records[0].Actor)
+		require.Equal(t, "balance", records[1].Changes[0].Field)
+
+		find := mt.GetStartedEvent().Command
+		require.Equal(t, "wallets_history", find.Lookup("find").StringValue())
+		require.Equal(t, "wallets", find.Lookup("filter", "collection").StringValue())
+		require.Equal(t, wallet.ID, find.Lookup("filter", "document_id").ObjectID())
+		require.Equal(t, int64(1), find.Lookup("sort", "timestamp").AsInt64())
+	})
+}
+
+func TestHistoryNotAuditable(t *testing.T) {
+	_, err := mgm.History(context.Background(), &Doc{})
+	require.Error(t, err)
+}
+
+func TestAuditCreateMany(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)
+
+		wallets := []mgm.Model{&Wallet{Owner: "Ali"}, &Wallet{Owner: "Mehran"}}
+		_, err := mgm.Coll(wallets[0]).CreateMany(context.Background(), wallets)
+		util.AssertErrIsNil(t, err)
+
+		require.Equal(t, "insert", mt.GetStartedEvent().CommandName)
+
+		for _, wallet := range wallets {
+			record := auditRecord(t, mt, "wallets_history")
+			require.Equal(t, "create", record.Lookup("op").StringValue())
+			require.Equal(t, wallet.GetID(), record.Lookup("document_id").ObjectID())
+		}
+	})
+}
+
+func TestAuditFindOneAndDelete(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{{Key: "_id", Value: id}, {Key: "total", Value: 5}}}),
+			mtest.CreateSuccessResponse(),
+		)
+
+		ledger := &Ledger{}
+		util.AssertErrIsNil(t, mgm.Coll(ledger).FindOneAndDelete(context.Background(), bson.M{"total": 5}, ledger))
+
+		require.Equal(t, "findAndModify", mt.GetStartedEvent().CommandName)
+
+		record := auditRecord(t, mt, mgm.AuditLogCollectionName)
+		require.Equal(t, "delete", record.Lookup("op").StringValue())
+		require.Equal(t, id, record.Lookup("document_id").ObjectID())
+	})
+}
+
+func TestAuditApplyUpdate(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		wallet := &Wallet{}
+		wallet.SetID(primitive.NewObjectID())
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.wallets", mtest.FirstBatch, bson.D{{Key: "_id", Value: wallet.ID}, {Key: "balance", Value: 10}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateCursorResponse(0, "db.wallets", mtest.FirstBatch, bson.D{{Key: "_id", Value: wallet.ID}, {Key: "balance", Value: 15}}),
+			mtest.CreateSuccessResponse(),
+		)
+
+		util.AssertErrIsNil(t, mgm.Coll(wallet).ApplyUpdate(wallet, builder.Update().Inc("balance", 5)))
+
+		require.Equal(t, "find", mt.GetStartedEvent().CommandName)
+		require.Equal(t, "update", mt.GetStartedEvent().CommandName)
+		require.Equal(t, "find", mt.GetStartedEvent().CommandName)
+
+		changes, err := auditRecord(t, mt, "wallets_history").Lookup("changes").Array().Values()
+		util.AssertErrIsNil(t, err)
+		require.Len(t, changes, 1)
+		require.Equal(t, int64(10), changes[0].Document().Lookup("old").AsInt64())
+		require.Equal(t, int64(15), changes[0].Document().Lookup("new").AsInt64())
+	})
+}
+
+func TestAuditUpsertManyUpdate(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.wallets", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: id},
+				{Key: "owner", Value: "Ali"},
+				{Key: "balance", Value: 10},
+			}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateSuccessResponse(),
+		)
+
+		wallet := &Wallet{Owner: "Ali", Balance: 20}
+		_, err := mgm.Coll(wallet).UpsertMany(context.Background(), []mgm.Model{wallet}, []string{"owner"})
+		util.AssertErrIsNil(t, err)
+		require.Equal(t, id, wallet.ID)
+
+		require.Equal(t, "find", mt.GetStartedEvent().CommandName)
+		require.Equal(t, "update", mt.GetStartedEvent().CommandName)
+
+		record := auditRecord(t, mt, "wallets_history")
+		require.Equal(t, "update", record.Lookup("op").StringValue())
+		require.Equal(t, id, record.Lookup("document_id").ObjectID())
+
+		changes, err := record.Lookup("changes").Array().Values()
+		util.AssertErrIsNil(t, err)
+		require.Len(t, changes, 1)
+		require.Equal(t, "balance", changes[0].Document().Lookup("field").StringValue())
+	})
+}
+
+func TestAuditNotRecordedOperations(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		ctx := context.Background()
+		wallet := &Wallet{}
+		coll := mgm.Coll(wallet)
+
+		require.True(t, errors.Is(coll.FindOneAndUpdate(ctx, bson.M{}, bson.M{"$inc": bson.M{"balance": 1}}, wallet), mgm.ErrNotRecorded))
+		require.True(t, errors.Is(coll.FindOneAndReplace(ctx, bson.M{}, wallet), mgm.ErrNotRecorded))
+
+		_, err := coll.Query().Delete(ctx)
+		require.True(t, errors.Is(err, mgm.ErrNotRecorded))
+
+		require.Nil(t, mt.GetStartedEvent())
+	})
+}
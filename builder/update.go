@@ -0,0 +1,163 @@
+package builder
+
+import (
+	o "github.com/uncle-gua/mgm/operator"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// UpdateBuilder builds update documents,
+// e.g Update().Inc("stock", -1).Push("history", entry).Unset("tmp")
+type UpdateBuilder struct {
+	doc          bson.M
+	arrayFilters []interface{}
+}
+
+// Update function returns a new update builder.
+func Update() *UpdateBuilder {
+	return &UpdateBuilder{doc: bson.M{}}
+}
+
+// Set adds a $set operator for the field.
+func (u *UpdateBuilder) Set(field string, val interface{}) *UpdateBuilder {
+	return u.add(o.Set, field, val)
+}
+
+// SetOnInsert adds a $setOnInsert operator for the field.
+func (u *UpdateBuilder) SetOnInsert(field string, val interface{}) *UpdateBuilder {
+	return u.add(o.SetOnInsert, field, val)
+}
+
+// Unset adds a $unset operator for the fields.
+func (u *UpdateBuilder) Unset(fields ...string) *UpdateBuilder {
+	for _, f := range fields {
+		u.add(o.Unset, f, "")
+	}
+	return u
+}
+
+// Inc adds a $inc operator for the field.
+func (u *UpdateBuilder) Inc(field string, val interface{}) *UpdateBuilder {
+	return u.add(o.Inc, field, val)
+}
+
+// Mul adds a $mul operator for the field.
+func (u *UpdateBuilder) Mul(field string, val interface{}) *UpdateBuilder {
+	return u.add(o.Mul, field, val)
+}
+
+// Min adds a $min operator for the field.
+func (u *UpdateBuilder) Min(field string, val interface{}) *UpdateBuilder {
+	return u.add(o.Min, field, val)
+}
+
+// Max adds a $max operator for the field.
+func (u *UpdateBuilder) Max(field string, val interface{}) *UpdateBuilder {
+	return u.add(o.Max, field, val)
+}
+
+// Rename adds a $rename operator for the field.
+func (u *UpdateBuilder) Rename(field, newName string) *UpdateBuilder {
+	return u.add(o.Rename, field, newName)
+}
+
+// CurrentDate adds a $currentDate operator for the field.
+func (u *UpdateBuilder) CurrentDate(field string) *UpdateBuilder {
+	return u.add(o.CurrentDate, field, true)
+}
+
+// Push adds a $push operator for the field.
+func (u *UpdateBuilder) Push(field string, val interface{}) *UpdateBuilder {
+	return u.add(o.Push, field, val)
+}
+
+// PushEach adds a $push operator with the $each modifier for the field.
+func (u *UpdateBuilder) PushEach(field string, values ...interface{}) *UpdateBuilder {
+	return u.add(o.Push, field, bson.M{o.Each: bson.A(values)})
+}
+
+// PushEachAt adds a $push operator with the $each and $position modifiers for the field.
+func (u *UpdateBuilder) PushEachAt(field string, position int, values ...interface{}) *UpdateBuilder {
+	return u.add(o.Push, field, bson.M{o.Each: bson.A(values), o.Position: position})
+}
+
+// AddToSet adds a $addToSet operator for the field.
+func (u *UpdateBuilder) AddToSet(field string, val interface{}) *UpdateBuilder {
+	return u.add(o.AddToSet, field, val)
+}
+
+// AddToSetEach adds a $addToSet operator with the $each modifier for the field.
+func (u *UpdateBuilder) AddToSetEach(field string, values ...interface{}) *UpdateBuilder {
+	return u.add(o.AddToSet, field, bson.M{o.Each: bson.A(values)})
+}
+
+// Pull adds a $pull operator for the field. The value can be a value or a condition.
+func (u *UpdateBuilder) Pull(field string, cond interface{}) *UpdateBuilder {
+	return u.add(o.Pull, field, cond)
+}
+
+// PullAll adds a $pullAll operator for the field.
+func (u *UpdateBuilder) PullAll(field string, values ...interface{}) *UpdateBuilder {
+	return u.add(o.PullAll, field, bson.A(values))
+}
+
+// PopFirst adds a $pop operator that removes the first element of the array field.
+func (u *UpdateBuilder) PopFirst(field string) *UpdateBuilder {
+	return u.add(o.Pop, field, -1)
+}
+
+// PopLast adds a $pop operator that removes the last element of the array field.
+func (u *UpdateBuilder) PopLast(field string) *UpdateBuilder {
+	return u.add(o.Pop, field, 1)
+}
+
+// Bit adds a $bit operator for the field. The op value must be one of "and", "or" or "xor".
+func (u *UpdateBuilder) Bit(field, op string, val interface{}) *UpdateBuilder {
+	return u.add(o.Bit, field, bson.M{op: val})
+}
+
+// ArrayFilters adds filters that determine which array elements
+// the `$[<identifier>]` positional operators update.
+func (u *UpdateBuilder) ArrayFilters(filters ...interface{}) *UpdateBuilder {
+	u.arrayFilters = append(u.arrayFilters, filters...)
+	return u
+}
+
+// GetArrayFilters returns the update's array filters.
+func (u *UpdateBuilder) GetArrayFilters() []interface{} {
+	return u.arrayFilters
+}
+
+// ToMap function returns the update document.
+func (u *UpdateBuilder) ToMap() bson.M {
+	return u.doc
+}
+
+func (u *UpdateBuilder) add(operator, field string, val interface{}) *UpdateBuilder {
+	m, ok := u.doc[operator].(bson.M)
+	if !ok {
+		m = bson.M{}
+		u.doc[operator] = m
+	}
+
+	m[field] = val
+	return u
+}
+
+// Positional returns the path of a field of the first array element
+// that matches the query, e.g Positional("items", "qty") is "items.$.qty".
+func Positional(array, field string) string {
+	return array + "." + o.Dollar + "." + field
+}
+
+// AllPositional returns the path of a field of all array elements,
+// e.g AllPositional("items", "qty") is "items.$[].qty".
+func AllPositional(array, field string) string {
+	return array + ".$[]." + field
+}
+
+// FilteredPositional returns the path of a field of the array elements that
+// match the identifier's array filter, e.g FilteredPositional("items", "elem", "qty")
+// is "items.$[elem].qty".
+func FilteredPositional(array, identifier, field string) string {
+	return array + ".$[" + identifier + "]." + field
+}
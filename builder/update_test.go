@@ -0,0 +1,53 @@
+package builder_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uncle-gua/mgm/builder"
+	"github.com/uncle-gua/mgm/operator"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestUpdate(t *testing.T) {
+	upd := builder.Update().
+		Set("name", "foo").
+		Inc("stock", -1).
+		Inc("sold", 1).
+		Push("history", "bar").
+		AddToSetEach("tags", "a", "b").
+		PushEachAt("queue", 0, "x").
+		PullAll("old", 1, 2).
+		PopFirst("list").
+		Bit("flags", "or", 4).
+		CurrentDate("seen_at").
+		Unset("tmp", "tmp2")
+
+	require.Equal(t, bson.M{
+		operator.Set:         bson.M{"name": "foo"},
+		operator.Inc:         bson.M{"stock": -1, "sold": 1},
+		operator.Push:        bson.M{"history": "bar", "queue": bson.M{operator.Each: bson.A{"x"}, operator.Position: 0}},
+		operator.AddToSet:    bson.M{"tags": bson.M{operator.Each: bson.A{"a", "b"}}},
+		operator.PullAll:     bson.M{"old": bson.A{1, 2}},
+		operator.Pop:         bson.M{"list": -1},
+		operator.Bit:         bson.M{"flags": bson.M{"or": 4}},
+		operator.CurrentDate: bson.M{"seen_at": true},
+		operator.Unset:       bson.M{"tmp": "", "tmp2": ""},
+	}, upd.ToMap())
+	require.Nil(t, upd.GetArrayFilters())
+}
+
+func TestUpdateArrayFilters(t *testing.T) {
+	upd := builder.Update().
+		Set(builder.FilteredPositional("items", "elem", "qty"), 0).
+		ArrayFilters(bson.M{"elem.qty": bson.M{operator.Lt: 0}})
+
+	require.Equal(t, bson.M{operator.Set: bson.M{"items.$[elem].qty": 0}}, upd.ToMap())
+	require.Equal(t, []interface{}{bson.M{"elem.qty": bson.M{operator.Lt: 0}}}, upd.GetArrayFilters())
+}
+
+func TestPositionalPaths(t *testing.T) {
+	require.Equal(t, "items.$.qty", builder.Positional("items", "qty"))
+	require.Equal(t, "items.$[].qty", builder.AllPositional("items", "qty"))
+	require.Equal(t, "items.$[elem].qty", builder.FilteredPositional("items", "elem", "qty"))
+}
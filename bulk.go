@@ -0,0 +1,577 @@
+package mgm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/uncle-gua/mgm/field"
+	"github.com/uncle-gua/mgm/operator"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrNotWritten is the error of the models that are not written because an
+// ordered bulk write stopped at the write of a previous model.
+var ErrNotWritten = errors.New("model is not written")
+
+// ModelError is the error of a model in a bulk operation.
+type ModelError struct {
+	// Index is the model's index in the models slice.
+	Index int
+	Err   error
+}
+
+func (e ModelError) Error() string {
+	return fmt.Sprintf("model %d: %v", e.Index, e.Err)
+}
+
+func (e ModelError) Unwrap() error {
+	return e.Err
+}
+
+// BulkError is returned by the bulk operations when some of the models fail.
+// If a model's hooks fail before the write, nothing is written. If an ordered
+// bulk write fails, the models after the failed one fail with ErrNotWritten.
+type BulkError struct {
+	Errors []ModelError
+	// Result is the result of the bulk write, nil if nothing is written.
+	Result *mongo.BulkWriteResult
+}
+
+func (e *BulkError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+
+	return fmt.Sprintf("%d models failed: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// CreateMany inserts the models using a single bulk write. It calls the models' creating
+// hooks before the write and their created hooks after it. Models with a zero ObjectID
+// get a new ID before the write. The write is ordered unless the options set it unordered.
+func (coll *Collection) CreateMany(ctx context.Context, models []Model, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+	before := func(_ int, model Model) (mongo.WriteModel, error) {
+		if err := callToBeforeCreateHooks(ctx, model); err != nil {
+			return nil, err
+		}
+
+		if id, ok := model.GetID().(primitive.ObjectID); ok && id.IsZero() {
+			model.SetID(primitive.NewObjectID())
+		}
+
+		return mongo.NewInsertOneModel().SetDocument(model), nil
+	}
+
+	after := func(_ int, model Model, _ int, _ *mongo.BulkWriteResult) error {
+		if err := recordChange(ctx, coll, model, AuditCreate, nil); err != nil {
+			return err
+		}
+
+		if err := takeSnapshot(model); err != nil {
+			return err
+		}
+
+		return callToAfterCreateHooks(ctx, model)
+	}
+
+	return coll.bulkWrite(ctx, models, before, after, opts)
+}
+
+// UpdateMany updates the models using a single bulk write, just like Update.
+// It calls the models' updating hooks before the write and their updated hooks
+// after it. The updated hooks get the result of the whole bulk write.
+// Versioned models whose documents are not matched fail with a VersionConflictError,
+// and the models that are not updated keep their versions.
+func (coll *Collection) UpdateMany(ctx context.Context, models []Model, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+	// versions contains the versions of the versioned models before the update.
+	versions := map[int]int64{}
+	updated := map[int]bool{}
+	stored := map[int]bson.Raw{}
+	writes := 0
+
+	var conflicts map[int]bool
+	var conflictsErr error
+
+	before := func(i int, model Model) (mongo.WriteModel, error) {
+		var err error
+		if stored[i], err = storedDocument(ctx, coll, model); err != nil {
+			return nil, err
+		}
+
+		if err := callToBeforeUpdateHooks(ctx, model); err != nil {
+			return nil, err
+		}
+
+		filter := bson.M{field.ID: model.GetID()}
+
+		if v, ok := model.(Versioned); ok {
+			versions[i] = v.GetVersion()
+			filter[field.Version] = versionFilter(v.GetVersion())
+			v.SetVersion(v.GetVersion() + 1)
+		}
+
+		doc, err := updateDocument(model, nil, nil, nil)
+		if err != nil || len(doc) == 0 {
+			return nil, err
+		}
+
+		writes++
+		return mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(doc), nil
+	}
+
+	after := func(i int, model Model, _ int, res *mongo.BulkWriteResult) error {
+		if version, ok := versions[i]; ok {
+			if conflicts == nil && conflictsErr == nil {
+				conflicts, conflictsErr = coll.versionConflicts(ctx, models, versions, res, writes)
+			}
+			if conflictsErr != nil {
+				return conflictsErr
+			}
+			if conflicts[i] {
+				return &VersionConflictError{ID: model.GetID(), Version: version}
+			}
+		}
+
+		updated[i] = true
+
+		if err := recordChange(ctx, coll, model, AuditUpdate, stored[i]); err != nil {
+			return err
+		}
+
+		if err := takeSnapshot(model); err != nil {
+			return err
+		}
+
+		return callToAfterUpdateHooks(ctx, &mongo.UpdateResult{
+			MatchedCount:  res.MatchedCount,
+			ModifiedCount: res.ModifiedCount,
+			UpsertedCount: res.UpsertedCount,
+		}, model)
+	}
+
+	res, err := coll.bulkWrite(ctx, models, before, after, opts)
+
+	for i, version := range versions {
+		if !updated[i] {
+			models[i].(Versioned).SetVersion(version)
+		}
+	}
+
+	return res, err
+}
+
+// versionConflicts returns the indexes of the versioned models whose documents are
+// not updated by the bulk write, i.e they don't have the models' new versions.
+func (coll *Collection) versionConflicts(ctx context.Context, models []Model, versions map[int]int64, res *mongo.BulkWriteResult, writes int) (map[int]bool, error) {
+	conflicts := map[int]bool{}
+	if res.MatchedCount >= int64(writes) {
+		return conflicts, nil
+	}
+
+	ids := make(bson.A, 0, len(versions))
+	for i := range versions {
+		ids = append(ids, models[i].GetID())
+	}
+
+	var docs []struct {
+		ID      bson.RawValue `bson:"_id"`
+		Version int64         `bson:"_v"`
+	}
+
+	opts := []*options.FindOptions{options.Find().SetProjection(bson.M{field.Version: 1})}
+	op := &OpInfo{Op: OpFind, Filter: bson.M{field.ID: bson.M{operator.In: ids}}, Options: opts}
+
+	err := coll.intercept(ctx, op, func(ctx context.Context, op *OpInfo) error {
+		opts, err := opOptions[*options.FindOptions](op)
+		if err != nil {
+			return err
+		}
+
+		cur, err := coll.collection(ctx).Find(ctx, op.Filter, opts...)
+		if err != nil {
+			return err
+		}
+		return cur.All(ctx, &docs)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stored := map[string]int64{}
+	for _, doc := range docs {
+		stored[string(doc.ID.Type)+string(doc.ID.Value)] = doc.Version
+	}
+
+	for i, version := range versions {
+		t, val, err := bson.MarshalValue(models[i].GetID())
+		if err != nil {
+			return nil, err
+		}
+
+		if v, ok := stored[string(t)+string(val)]; !ok || v != version+1 {
+			conflicts[i] = true
+		}
+	}
+
+	return conflicts, nil
+}
+
+// DeleteModels deletes the models using a single bulk write, just like Delete.
+// It calls the models' deleting hooks before the write and their deleted hooks
+// after it. The deleted hooks get the result of the whole bulk write.
+func (coll *Collection) DeleteModels(ctx context.Context, models []Model, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+	now := time.Now().UTC()
+	stored := map[int]bson.Raw{}
+
+	before := func(i int, model Model) (mongo.WriteModel, error) {
+		if err := callToBeforeDeleteHooks(ctx, model); err != nil {
+			return nil, err
+		}
+
+		var err error
+		if stored[i], err = storedDocument(ctx, coll, model); err != nil {
+			return nil, err
+		}
+
+		if _, ok := model.(SoftDeletable); ok {
+			filter := bson.M{field.ID: model.GetID(), field.DeletedAt: nil}
+			return mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(bson.M{operator.Set: bson.M{field.DeletedAt: now}}), nil
+		}
+
+		return mongo.NewDeleteOneModel().SetFilter(bson.M{field.ID: model.GetID()}), nil
+	}
+
+	after := func(i int, model Model, _ int, res *mongo.BulkWriteResult) error {
+		if sd, ok := model.(SoftDeletable); ok {
+			// Soft-deleted documents are not deleted again.
+			if deletedAt, err := stored[i].LookupErr(field.DeletedAt); err == nil && deletedAt.Type != bson.TypeNull {
+				stored[i] = nil
+			}
+
+			sd.SetDeletedAt(&now)
+		}
+
+		if err := recordChange(ctx, coll, model, AuditDelete, stored[i]); err != nil {
+			return err
+		}
+
+		return callToAfterDeleteHooks(ctx, &mongo.DeleteResult{DeletedCount: res.DeletedCount + res.ModifiedCount}, model)
+	}
+
+	return coll.bulkWrite(ctx, models, before, after, opts)
+}
+
+// UpsertMany inserts the models, or updates the documents that have the same key fields
+// (e.g "email"), using a single bulk write. The key fields default to `_id`, so models
+// with a zero ObjectID get a new ID and are inserted. The models'
+// creating hooks are called before the write, then their created or updated hooks are
+// called depending on what happened. The `_id` and `created_at` fields are just set
+// when inserting a document. Inserted models get their new ID, and auditable and
+// revisioned models whose documents are updated get the ID of their document.
+func (coll *Collection) UpsertMany(ctx context.Context, models []Model, keyFields []string, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+	stored := map[int]bson.Raw{}
+
+	before := func(i int, model Model) (mongo.WriteModel, error) {
+		if err := callToBeforeCreateHooks(ctx, model); err != nil {
+			return nil, err
+		}
+
+		filter, doc, err := upsertDocument(model, keyFields)
+		if err != nil {
+			return nil, err
+		}
+
+		if isRecorded(model) {
+			if stored[i], err = findDocument(ctx, coll, model, filter); err != nil {
+				return nil, err
+			}
+		}
+
+		return mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(doc).SetUpsert(true), nil
+	}
+
+	after := func(i int, model Model, write int, res *mongo.BulkWriteResult) error {
+		id, inserted := res.UpsertedIDs[int64(write)]
+		if inserted && id != nil {
+			model.SetID(id)
+		}
+
+		if err := recordUpsert(ctx, coll, model, inserted, stored[i]); err != nil {
+			return err
+		}
+
+		if err := takeSnapshot(model); err != nil {
+			return err
+		}
+
+		if inserted {
+			return callToAfterCreateHooks(ctx, model)
+		}
+
+		return callToAfterUpdateHooks(ctx, &mongo.UpdateResult{MatchedCount: 1}, model)
+	}
+
+	return coll.bulkWrite(ctx, models, before, after, opts)
+}
+
+// recordUpsert records the change of an upserted model. The stored document is the
+// document that matched the upsert's filter before the write.
+func recordUpsert(ctx context.Context, coll *Collection, model Model, inserted bool, stored bson.Raw) error {
+	if inserted {
+		return recordChange(ctx, coll, model, AuditCreate, nil)
+	}
+	if stored == nil {
+		return nil
+	}
+
+	id := stored.Lookup(field.ID)
+	var storedID interface{}
+	if err := id.Unmarshal(&storedID); err != nil {
+		return err
+	}
+	model.SetID(storedID)
+
+	raw, err := bson.Marshal(model)
+	if err != nil {
+		return err
+	}
+
+	// The upsert sets the model's fields, except the ones that are just set on insert.
+	var after, set bson.D
+	if err := bson.Unmarshal(stored, &after); err != nil {
+		return err
+	}
+	if err := bson.Unmarshal(raw, &set); err != nil {
+		return err
+	}
+
+	for _, e := range set {
+		if e.Key == field.ID || e.Key == field.CreatedAt {
+			continue
+		}
+
+		found := false
+		for j := range after {
+			if after[j].Key == e.Key {
+				after[j].Value, found = e.Value, true
+			}
+		}
+		if !found {
+			after = append(after, e)
+		}
+	}
+
+	doc, err := bson.Marshal(after)
+	if err != nil {
+		return err
+	}
+
+	return recordDocument(ctx, coll, model, AuditUpdate, stored, doc)
+}
+
+// upsertDocument returns the filter and update document that upsert
+// the model by its key fields. If `_id` is a key field and the model has
+// a zero ObjectID, the model gets a new ID, so it's inserted rather than
+// upserting the document whose `_id` is null.
+func upsertDocument(model Model, keyFields []string) (bson.D, bson.D, error) {
+	if len(keyFields) == 0 {
+		keyFields = []string{field.ID}
+	}
+
+	setUpsertID(model, keyFields)
+
+	raw, err := bson.Marshal(model)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	filter := bson.D{}
+	for _, key := range keyFields {
+		val, err := bson.Raw(raw).LookupErr(strings.Split(key, ".")...)
+		if err != nil {
+			val = bson.RawValue{Type: bson.TypeNull}
+		}
+		filter = append(filter, bson.E{Key: key, Value: val})
+	}
+
+	elems, err := bson.Raw(raw).Elements()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	set, setOnInsert := bson.D{}, bson.D{}
+	for _, e := range elems {
+		if e.Key() == field.ID || e.Key() == field.CreatedAt {
+			setOnInsert = append(setOnInsert, bson.E{Key: e.Key(), Value: e.Value()})
+		} else {
+			set = append(set, bson.E{Key: e.Key(), Value: e.Value()})
+		}
+	}
+
+	doc := bson.D{}
+	if len(set) != 0 {
+		doc = append(doc, bson.E{Key: operator.Set, Value: set})
+	}
+	if len(setOnInsert) != 0 {
+		doc = append(doc, bson.E{Key: operator.SetOnInsert, Value: setOnInsert})
+	}
+
+	return filter, doc, nil
+}
+
+// setUpsertID sets a new ID to a model with a zero ObjectID that is upserted by its
+// `_id` (the default key field). It returns true if the model gets a new ID.
+func setUpsertID(model Model, keyFields []string) bool {
+	id, ok := model.GetID().(primitive.ObjectID)
+	if !ok || !id.IsZero() {
+		return false
+	}
+
+	for _, key := range keyFields {
+		if key == field.ID {
+			model.SetID(primitive.NewObjectID())
+			return true
+		}
+	}
+
+	if len(keyFields) == 0 {
+		model.SetID(primitive.NewObjectID())
+		return true
+	}
+
+	return false
+}
+
+// bulkWrite writes the models using a single bulk write. The before function
+// returns a model's write, or nil if the model has nothing to write. The after
+// function is called for each written model with the index of its write.
+// Both functions get the model's index too.
+func (coll *Collection) bulkWrite(ctx context.Context, models []Model,
+	before func(i int, model Model) (mongo.WriteModel, error),
+	after func(i int, model Model, write int, res *mongo.BulkWriteResult) error,
+	opts []*options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+
+	var errs []ModelError
+	var writes []interface{}
+	// modelWrites contains the index of each model's write, or -1.
+	modelWrites := make([]int, len(models))
+
+	for i, model := range models {
+		modelWrites[i] = -1
+
+		w, err := before(i, model)
+		if err != nil {
+			errs = append(errs, ModelError{Index: i, Err: err})
+			continue
+		}
+		if w != nil {
+			modelWrites[i] = len(writes)
+			writes = append(writes, w)
+		}
+	}
+
+	if len(errs) != 0 {
+		return nil, &BulkError{Errors: errs}
+	}
+
+	res := &mongo.BulkWriteResult{UpsertedIDs: map[int64]interface{}{}}
+	failed := map[int]error{}
+	// stop is the index of the first model that is not written in an ordered bulk write.
+	stop := len(models)
+
+	if len(writes) != 0 {
+		op := &OpInfo{Op: OpBulkWrite, Documents: writes, Options: opts}
+
+		err := coll.intercept(ctx, op, func(ctx context.Context, op *OpInfo) error {
+			wms := make([]mongo.WriteModel, len(op.Documents))
+			for i, w := range op.Documents {
+				wm, ok := w.(mongo.WriteModel)
+				if !ok {
+					return fmt.Errorf("%w: the documents of %s operations must be mongo.WriteModel values, got %T", ErrInvalidOpInfo, op.Op, w)
+				}
+				wms[i] = wm
+			}
+
+			opts, err := opOptions[*options.BulkWriteOptions](op)
+			if err != nil {
+				return err
+			}
+
+			r, err := coll.collection(ctx).BulkWrite(ctx, wms, opts...)
+			if r != nil {
+				res = r
+			}
+			return err
+		})
+
+		var bulkErr mongo.BulkWriteException
+		if err != nil && !errors.As(err, &bulkErr) {
+			return nil, err
+		}
+
+		for _, we := range bulkErr.WriteErrors {
+			// A write exception supports the driver's error helpers, e.g mongo.IsDuplicateKeyError.
+			failed[we.Index] = mongo.WriteException{WriteErrors: mongo.WriteErrors{we.WriteError}}
+		}
+		if bulkErr.WriteConcernError != nil {
+			return res, err
+		}
+
+		if len(failed) != 0 && isOrdered(opts) {
+			firstFailed := len(writes)
+			for idx := range failed {
+				if idx < firstFailed {
+					firstFailed = idx
+				}
+			}
+			for i, w := range modelWrites {
+				if w == firstFailed {
+					stop = i
+				}
+			}
+		}
+	}
+
+	for i, model := range models {
+		w := modelWrites[i]
+		if err, ok := failed[w]; ok && w != -1 {
+			errs = append(errs, ModelError{Index: i, Err: err})
+			continue
+		}
+		if i > stop {
+			if w != -1 {
+				errs = append(errs, ModelError{Index: i, Err: ErrNotWritten})
+			}
+			continue
+		}
+
+		if err := after(i, model, w, res); err != nil {
+			errs = append(errs, ModelError{Index: i, Err: err})
+		}
+	}
+
+	if len(errs) != 0 {
+		return res, &BulkError{Errors: errs, Result: res}
+	}
+
+	return res, nil
+}
+
+// isOrdered returns true if the bulk write is ordered, which is the default.
+func isOrdered(opts []*options.BulkWriteOptions) bool {
+	ordered := true
+
+	for _, opt := range opts {
+		if opt != nil && opt.Ordered != nil {
+			ordered = *opt.Ordered
+		}
+	}
+
+	return ordered
+}
@@ -0,0 +1,278 @@
+package mgm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uncle-gua/mgm"
+	"github.com/uncle-gua/mgm/internal/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Ticket struct {
+	mgm.DefaultModel `bson:",inline"`
+
+	Email string `bson:"email" mgm:"required"`
+
+	created  int
+	updated  int
+	deleting int
+	deleted  int
+}
+
+func (t *Ticket) Created(ctx context.Context) error {
+	t.created++
+	return nil
+}
+
+func (t *Ticket) Updated(ctx context.Context, res *mongo.UpdateResult) error {
+	t.updated++
+	return nil
+}
+
+func (t *Ticket) Deleting(ctx context.Context) error {
+	t.deleting++
+	return nil
+}
+
+func (t *Ticket) Deleted(ctx context.Context, res *mongo.DeleteResult) error {
+	t.deleted++
+	return nil
+}
+
+func tickets(emails ...string) []mgm.Model {
+	models := make([]mgm.Model, len(emails))
+	for i, email := range emails {
+		models[i] = &Ticket{Email: email}
+	}
+	return models
+}
+
+func TestCreateMany(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}))
+
+		models := tickets("a@x.io", "b@x.io")
+		res, err := coll.CreateMany(context.Background(), models)
+		util.AssertErrIsNil(t, err)
+		require.Equal(t, int64(2), res.InsertedCount)
+
+		docs, err := mt.GetStartedEvent().Command.Lookup("documents").Array().Values()
+		util.AssertErrIsNil(t, err)
+		require.Len(t, docs, 2)
+
+		for i, m := range models {
+			ticket := m.(*Ticket)
+			require.False(t, ticket.ID.IsZero())
+			require.False(t, ticket.CreatedAt.IsZero())
+			require.Equal(t, 1, ticket.created)
+			require.Equal(t, ticket.ID, docs[i].Document().Lookup("_id").ObjectID())
+		}
+	})
+}
+
+func TestCreateManyUnorderedPartialFailure(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"}))
+
+		models := tickets("a@x.io", "b@x.io")
+		_, err := coll.CreateMany(context.Background(), models, options.BulkWrite().SetOrdered(false))
+
+		var bulkErr *mgm.BulkError
+		require.True(t, errors.As(err, &bulkErr))
+		require.Len(t, bulkErr.Errors, 1)
+		require.Equal(t, 0, bulkErr.Errors[0].Index)
+		require.True(t, mongo.IsDuplicateKeyError(bulkErr.Errors[0].Err))
+
+		require.Equal(t, 0, models[0].(*Ticket).created)
+		require.Equal(t, 1, models[1].(*Ticket).created)
+	})
+}
+
+func TestCreateManyOrderedFailureStops(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 1, Code: 11000, Message: "duplicate key"}))
+
+		models := tickets("a@x.io", "b@x.io", "c@x.io")
+		_, err := coll.CreateMany(context.Background(), models)
+
+		var bulkErr *mgm.BulkError
+		require.True(t, errors.As(err, &bulkErr))
+		require.Len(t, bulkErr.Errors, 2)
+		require.Equal(t, 1, bulkErr.Errors[0].Index)
+		require.True(t, mongo.IsDuplicateKeyError(bulkErr.Errors[0].Err))
+		require.Equal(t, 2, bulkErr.Errors[1].Index)
+		require.True(t, errors.Is(bulkErr.Errors[1], mgm.ErrNotWritten))
+
+		require.Equal(t, []int{1, 0, 0}, []int{models[0].(*Ticket).created, models[1].(*Ticket).created, models[2].(*Ticket).created})
+	})
+}
+
+func TestCreateManyHookFailureWritesNothing(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		_, err := coll.CreateMany(context.Background(), tickets("a@x.io", ""))
+
+		var bulkErr *mgm.BulkError
+		require.True(t, errors.As(err, &bulkErr))
+		require.Equal(t, 1, bulkErr.Errors[0].Index)
+
+		var validationErrs mgm.ValidationErrors
+		require.True(t, errors.As(bulkErr.Errors[0], &validationErrs))
+
+		require.Nil(t, mt.GetStartedEvent())
+	})
+}
+
+func TestUpdateMany(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}, bson.E{Key: "nModified", Value: 2}))
+
+		models := tickets("a@x.io", "b@x.io")
+		for _, m := range models {
+			m.SetID(primitive.NewObjectID())
+		}
+
+		_, err := coll.UpdateMany(context.Background(), models)
+		util.AssertErrIsNil(t, err)
+
+		updates, err := mt.GetStartedEvent().Command.Lookup("updates").Array().Values()
+		util.AssertErrIsNil(t, err)
+		require.Len(t, updates, 2)
+		require.Equal(t, models[1].GetID(), updates[1].Document().Lookup("q", "_id").ObjectID())
+		require.Equal(t, "b@x.io", updates[1].Document().Lookup("u", "$set", "email").StringValue())
+
+		require.Equal(t, 1, models[0].(*Ticket).updated)
+	})
+}
+
+func TestUpdateManyVersionConflict(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		orders := []mgm.Model{&Order{Total: 1}, &Order{Total: 2}}
+		for _, m := range orders {
+			m.SetID(primitive.NewObjectID())
+			m.(*Order).Version = 1
+		}
+
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateCursorResponse(0, "db.orders", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: orders[0].GetID()}, {Key: "_v", Value: 2}},
+				bson.D{{Key: "_id", Value: orders[1].GetID()}, {Key: "_v", Value: 5}},
+			),
+		)
+
+		_, err := coll.UpdateMany(context.Background(), orders)
+
+		var bulkErr *mgm.BulkError
+		require.True(t, errors.As(err, &bulkErr))
+		require.Len(t, bulkErr.Errors, 1)
+		require.Equal(t, 1, bulkErr.Errors[0].Index)
+		require.True(t, errors.Is(bulkErr.Errors[0], mgm.ErrVersionConflict))
+
+		require.Equal(t, int64(2), orders[0].(*Order).Version)
+		require.Equal(t, int64(1), orders[1].(*Order).Version)
+
+		mt.GetStartedEvent()
+		ids, err := mt.GetStartedEvent().Command.Lookup("filter", "_id", "$in").Array().Values()
+		util.AssertErrIsNil(t, err)
+		require.Len(t, ids, 2)
+	})
+}
+
+func TestUpdateManyHookFailureKeepsVersions(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		order := &Order{Total: 1}
+		order.SetID(primitive.NewObjectID())
+		order.Version = 3
+
+		invalid := &Ticket{}
+		invalid.SetID(primitive.NewObjectID())
+
+		_, err := coll.UpdateMany(context.Background(), []mgm.Model{order, invalid})
+
+		var bulkErr *mgm.BulkError
+		require.True(t, errors.As(err, &bulkErr))
+		require.Equal(t, 1, bulkErr.Errors[0].Index)
+
+		require.Equal(t, int64(3), order.Version)
+		require.Nil(t, mt.GetStartedEvent())
+	})
+}
+
+func TestUpsertMany(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		insertedID := primitive.NewObjectID()
+		mt.AddMockResponses(mtest.CreateSuccessResponse(
+			bson.E{Key: "n", Value: 2},
+			bson.E{Key: "nModified", Value: 1},
+			bson.E{Key: "upserted", Value: bson.A{bson.D{{Key: "index", Value: 1}, {Key: "_id", Value: insertedID}}}},
+		))
+
+		models := tickets("a@x.io", "b@x.io")
+		res, err := coll.UpsertMany(context.Background(), models, []string{"email"})
+		util.AssertErrIsNil(t, err)
+		require.Equal(t, int64(1), res.UpsertedCount)
+
+		require.Equal(t, 1, models[0].(*Ticket).updated)
+		require.Equal(t, 0, models[0].(*Ticket).created)
+		require.Equal(t, 1, models[1].(*Ticket).created)
+		require.Equal(t, insertedID, models[1].GetID())
+
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		require.Equal(t, "a@x.io", update.Lookup("q", "email").StringValue())
+		require.True(t, update.Lookup("upsert").Boolean())
+		require.Equal(t, bson.TypeDateTime, update.Lookup("u", "$setOnInsert", "created_at").Type)
+
+		_, err = update.LookupErr("u", "$set", "created_at")
+		require.Error(t, err)
+	})
+}
+
+func TestUpsertManyByID(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		existingID := primitive.NewObjectID()
+		mt.AddMockResponses(mtest.CreateSuccessResponse(
+			bson.E{Key: "n", Value: 2},
+			bson.E{Key: "nModified", Value: 1},
+			bson.E{Key: "upserted", Value: bson.A{bson.D{{Key: "index", Value: 1}}}},
+		))
+
+		models := tickets("a@x.io", "b@x.io")
+		models[0].SetID(existingID)
+
+		_, err := coll.UpsertMany(context.Background(), models, nil)
+		util.AssertErrIsNil(t, err)
+
+		updates, err := mt.GetStartedEvent().Command.Lookup("updates").Array().Values()
+		util.AssertErrIsNil(t, err)
+		require.Equal(t, existingID, updates[0].Document().Lookup("q", "_id").ObjectID())
+
+		// The new model gets an ID rather than upserting `{_id: null}`.
+		newID := models[1].(*Ticket).ID
+		require.False(t, newID.IsZero())
+		require.Equal(t, newID, updates[1].Document().Lookup("q", "_id").ObjectID())
+		require.Equal(t, newID, updates[1].Document().Lookup("u", "$setOnInsert", "_id").ObjectID())
+		require.Equal(t, 1, models[1].(*Ticket).created)
+	})
+}
+
+func TestDeleteModels(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}))
+
+		models := tickets("a@x.io", "b@x.io")
+		res, err := coll.DeleteModels(context.Background(), models)
+		util.AssertErrIsNil(t, err)
+		require.Equal(t, int64(2), res.DeletedCount)
+
+		evt := mt.GetStartedEvent()
+		require.Equal(t, "delete", evt.CommandName)
+		require.Equal(t, 1, models[1].(*Ticket).deleted)
+	})
+}
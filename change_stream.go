@@ -0,0 +1,394 @@
+package mgm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/uncle-gua/mgm/field"
+	"github.com/uncle-gua/mgm/operator"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ChangeOp is the operation type of a change event.
+type ChangeOp string
+
+// The operation types of change events.
+const (
+	ChangeInsert     ChangeOp = "insert"
+	ChangeUpdate     ChangeOp = "update"
+	ChangeReplace    ChangeOp = "replace"
+	ChangeDelete     ChangeOp = "delete"
+	ChangeDrop       ChangeOp = "drop"
+	ChangeRename     ChangeOp = "rename"
+	ChangeInvalidate ChangeOp = "invalidate"
+)
+
+// ChangeEvent is a change of a collection's document.
+type ChangeEvent struct {
+	Op ChangeOp
+	// DocumentKey contains the `_id` (and the shard key) of the changed document.
+	DocumentKey bson.M
+	// Model is the decoded full document, nil if the event does not contain it
+	// (e.g delete events) or the stream has no model.
+	Model Model
+	// UpdatedFields and RemovedFields are the changed fields of update events,
+	// by their dotted path.
+	UpdatedFields bson.M
+	RemovedFields []string
+	ResumeToken   bson.Raw
+	ClusterTime   primitive.Timestamp
+}
+
+// ResumeTokenStore stores the resume tokens of change streams by their name,
+// so a stream resumes after the last event it processed when it's opened again.
+type ResumeTokenStore interface {
+	// LoadResumeToken returns the stream's token, or nil if there is no token.
+	LoadResumeToken(ctx context.Context, name string) (bson.Raw, error)
+	SaveResumeToken(ctx context.Context, name string, token bson.Raw) error
+}
+
+// WatchOptions are the options of a change stream.
+type WatchOptions struct {
+	// Model is a model of the collection (e.g &Book{}). Events' full documents are
+	// decoded into new models of its type. The stream looks up the full document
+	// of update events unless the change stream options specify another value.
+	Model Model
+	// Store checkpoints the stream's resume token. The stream resumes from the
+	// stored token when it's opened.
+	Store ResumeTokenStore
+	// Name is the stream's name in the store, it defaults to the collection's name.
+	Name string
+	// Backoff is the wait before reconnecting the stream, it doubles on each
+	// failed attempt up to MaxBackoff. They default to 500ms and 30s.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// MaxRetries is the number of attempts to reconnect the stream before Next
+	// fails, zero retries until the context is done.
+	MaxRetries int
+	// ChangeStreamOptions are the driver options of the stream.
+	ChangeStreamOptions *options.ChangeStreamOptions
+}
+
+// ChangeStream is a stream of a collection's change events. It reconnects,
+// resuming after the last event, when the stream fails.
+type ChangeStream struct {
+	coll     *Collection
+	pipeline interface{}
+	opts     WatchOptions
+
+	cs    *mongo.ChangeStream
+	event *ChangeEvent
+	// token is the resume token of the last event, or the stream's
+	// post-batch token when it's reconnected.
+	token bson.Raw
+	// pending is true when the last event is not checkpointed.
+	pending bool
+	done    bool
+	err     error
+}
+
+// Watch opens a change stream of the collection's changes, filtered by the pipeline
+// (e.g a `$match` stage on the operationType). The opts can be nil.
+//
+// Each call to Next checkpoints the previous event's resume token into the store,
+// so an event is delivered again if the process stops before the next Next call.
+func (coll *Collection) Watch(ctx context.Context, pipeline interface{}, opts *WatchOptions) (*ChangeStream, error) {
+	if pipeline == nil {
+		pipeline = mongo.Pipeline{}
+	}
+
+	s := &ChangeStream{coll: coll, pipeline: pipeline}
+	if opts != nil {
+		s.opts = *opts
+	}
+
+	if s.opts.Name == "" {
+		s.opts.Name = coll.Name()
+	}
+	if s.opts.Backoff == 0 {
+		s.opts.Backoff = 500 * time.Millisecond
+	}
+	if s.opts.MaxBackoff == 0 {
+		s.opts.MaxBackoff = 30 * time.Second
+	}
+
+	if s.opts.Store != nil {
+		token, err := s.opts.Store.LoadResumeToken(ctx, s.opts.Name)
+		if err != nil {
+			return nil, err
+		}
+		s.token = token
+	}
+
+	if err := s.open(ctx); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Watch opens a change stream of the collection's changes, see Collection.Watch.
+// The events' full documents are decoded into models of type T.
+func (tc *TypedCollection[T]) Watch(ctx context.Context, pipeline interface{}, opts *WatchOptions) (*ChangeStream, error) {
+	o := WatchOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	o.Model = newModel[T]()
+
+	return tc.coll.Watch(ctx, pipeline, &o)
+}
+
+func (s *ChangeStream) open(ctx context.Context) error {
+	opts := options.MergeChangeStreamOptions(s.opts.ChangeStreamOptions)
+
+	// The options' default is options.Default, which does not look up the full document.
+	if s.opts.Model != nil && (opts.FullDocument == nil || *opts.FullDocument == options.Default) {
+		opts.SetFullDocument(options.UpdateLookup)
+	}
+	if s.token != nil {
+		opts.SetResumeAfter(s.token)
+		opts.StartAfter = nil
+		opts.StartAtOperationTime = nil
+	}
+
+	op := &OpInfo{Op: OpWatch, Filter: s.pipeline, Options: []*options.ChangeStreamOptions{opts}}
+
+	return s.coll.intercept(ctx, op, func(ctx context.Context, op *OpInfo) (err error) {
+		opts, err := opOptions[*options.ChangeStreamOptions](op)
+		if err != nil {
+			return err
+		}
+
+		s.cs, err = s.coll.collection(ctx).Watch(ctx, op.Filter, opts...)
+		return err
+	})
+}
+
+// Next checkpoints the previous event, then waits for the next event. It returns
+// false when the context is done, the stream fails or it's invalidated (e.g the
+// collection is dropped). Check Err for the error. The stream is not reconnected
+// after the errors that can't be resumed, e.g when the oplog has lost its history.
+func (s *ChangeStream) Next(ctx context.Context) bool {
+	if s.err != nil || s.done {
+		return false
+	}
+
+	if err := s.Checkpoint(ctx); err != nil {
+		s.err = err
+		return false
+	}
+
+	s.event = nil
+
+	var err error
+	for retries := 0; ; retries++ {
+		if s.cs != nil {
+			if s.cs.Next(ctx) {
+				return s.decode(ctx)
+			}
+
+			if err = s.cs.Err(); err == nil {
+				// The stream is closed after an invalidate event.
+				s.done = true
+				return false
+			}
+		}
+
+		if ctx.Err() != nil {
+			s.err = ctx.Err()
+			return false
+		}
+
+		if !resumable(err) || s.opts.MaxRetries > 0 && retries >= s.opts.MaxRetries {
+			s.err = err
+			return false
+		}
+
+		// Resume after the events the server has returned, even if there are none.
+		if s.cs != nil && s.cs.ResumeToken() != nil {
+			s.token = s.cs.ResumeToken()
+		}
+		s.closeCursor(ctx)
+
+		select {
+		case <-ctx.Done():
+			s.err = ctx.Err()
+			return false
+		case <-time.After(s.backoff(retries)):
+		}
+
+		err = s.open(ctx)
+	}
+}
+
+// nonResumableCodes are the codes of the server errors that fail a stream
+// that is reconnected: InvalidResumeToken, ChangeStreamFatalError and
+// ChangeStreamHistoryLost.
+var nonResumableCodes = []int{260, 280, 286}
+
+// resumable returns false if the stream can't be reconnected after the error.
+func resumable(err error) bool {
+	var serverErr mongo.ServerError
+	if !errors.As(err, &serverErr) {
+		return true
+	}
+
+	for _, code := range nonResumableCodes {
+		if serverErr.HasErrorCode(code) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Event returns the current event.
+func (s *ChangeStream) Event() *ChangeEvent {
+	return s.event
+}
+
+// Err returns the error that stopped the stream.
+func (s *ChangeStream) Err() error {
+	return s.err
+}
+
+// Checkpoint saves the resume token of the current event into the store. Next
+// calls it, so call it just to checkpoint an event before the next one.
+func (s *ChangeStream) Checkpoint(ctx context.Context) error {
+	if !s.pending || s.opts.Store == nil {
+		return nil
+	}
+
+	if err := s.opts.Store.SaveResumeToken(ctx, s.opts.Name, s.token); err != nil {
+		return err
+	}
+
+	s.pending = false
+	return nil
+}
+
+// Close closes the stream. It does not checkpoint the current event.
+func (s *ChangeStream) Close(ctx context.Context) error {
+	s.done = true
+
+	return s.closeCursor(ctx)
+}
+
+func (s *ChangeStream) closeCursor(ctx context.Context) error {
+	if s.cs == nil {
+		return nil
+	}
+
+	err := s.cs.Close(ctx)
+	s.cs = nil
+
+	return err
+}
+
+// backoff returns the wait before a reconnect attempt.
+func (s *ChangeStream) backoff(attempt int) time.Duration {
+	d := s.opts.Backoff
+	for i := 0; i < attempt && d < s.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+
+	if d > s.opts.MaxBackoff {
+		return s.opts.MaxBackoff
+	}
+
+	return d
+}
+
+// decode decodes the stream's current event.
+func (s *ChangeStream) decode(ctx context.Context) bool {
+	var raw struct {
+		ID                bson.Raw            `bson:"_id"`
+		OperationType     ChangeOp            `bson:"operationType"`
+		FullDocument      bson.RawValue       `bson:"fullDocument"`
+		DocumentKey       bson.M              `bson:"documentKey"`
+		ClusterTime       primitive.Timestamp `bson:"clusterTime"`
+		UpdateDescription struct {
+			UpdatedFields bson.M   `bson:"updatedFields"`
+			RemovedFields []string `bson:"removedFields"`
+		} `bson:"updateDescription"`
+	}
+
+	if err := s.cs.Decode(&raw); err != nil {
+		s.err = err
+		return false
+	}
+
+	event := &ChangeEvent{
+		Op:            raw.OperationType,
+		DocumentKey:   raw.DocumentKey,
+		UpdatedFields: raw.UpdateDescription.UpdatedFields,
+		RemovedFields: raw.UpdateDescription.RemovedFields,
+		ResumeToken:   raw.ID,
+		ClusterTime:   raw.ClusterTime,
+	}
+
+	if s.opts.Model != nil && raw.FullDocument.Type == bson.TypeEmbeddedDocument {
+		model := reflect.New(reflect.TypeOf(s.opts.Model).Elem()).Interface().(Model)
+
+		if err := raw.FullDocument.Unmarshal(model); err != nil {
+			s.err = err
+			return false
+		}
+		if err := takeSnapshot(model); err != nil {
+			s.err = err
+			return false
+		}
+		if err := callToFoundHooks(ctx, model); err != nil {
+			s.err = err
+			return false
+		}
+
+		event.Model = model
+	}
+
+	s.event = event
+	s.token = raw.ID
+	s.pending = true
+
+	return true
+}
+
+// CollectionTokenStore is a ResumeTokenStore that stores the resume tokens
+// in a collection, using the streams' names as the documents' IDs.
+type CollectionTokenStore struct {
+	coll *Collection
+}
+
+// NewCollectionTokenStore returns a new store of resume tokens in the collection,
+// e.g `mgm.NewCollectionTokenStore(mgm.CollectionByName("resume_tokens"))`.
+func NewCollectionTokenStore(coll *Collection) *CollectionTokenStore {
+	return &CollectionTokenStore{coll: coll}
+}
+
+// LoadResumeToken returns the stream's token, or nil if there is no token.
+func (s *CollectionTokenStore) LoadResumeToken(ctx context.Context, name string) (bson.Raw, error) {
+	var doc struct {
+		Token bson.Raw `bson:"token"`
+	}
+
+	err := s.coll.collection(ctx).FindOne(ctx, bson.M{field.ID: name}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+
+	return doc.Token, err
+}
+
+// SaveResumeToken saves the stream's token.
+func (s *CollectionTokenStore) SaveResumeToken(ctx context.Context, name string, token bson.Raw) error {
+	update := bson.M{operator.Set: bson.M{"token": token, field.UpdatedAt: time.Now().UTC()}}
+
+	_, err := s.coll.collection(ctx).UpdateOne(ctx, bson.M{field.ID: name}, update, options.Update().SetUpsert(true))
+	return err
+}
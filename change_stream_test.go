@@ -0,0 +1,252 @@
+package mgm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uncle-gua/mgm"
+	"github.com/uncle-gua/mgm/internal/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+type memoryTokenStore map[string]bson.Raw
+
+func (s memoryTokenStore) LoadResumeToken(ctx context.Context, name string) (bson.Raw, error) {
+	return s[name], nil
+}
+
+func (s memoryTokenStore) SaveResumeToken(ctx context.Context, name string, token bson.Raw) error {
+	s[name] = token
+	return nil
+}
+
+func resumeToken(data string) bson.D {
+	return bson.D{{Key: "_data", Value: data}}
+}
+
+func TestWatch(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		id := primitive.NewObjectID()
+		ns := "models." + coll.Name()
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(1, ns, mtest.FirstBatch,
+			bson.D{
+				{Key: "_id", Value: resumeToken("1")},
+				{Key: "operationType", Value: "insert"},
+				{Key: "documentKey", Value: bson.D{{Key: "_id", Value: id}}},
+				{Key: "fullDocument", Value: bson.D{{Key: "_id", Value: id}, {Key: "email", Value: "a@x.io"}}},
+			},
+			bson.D{
+				{Key: "_id", Value: resumeToken("2")},
+				{Key: "operationType", Value: "update"},
+				{Key: "documentKey", Value: bson.D{{Key: "_id", Value: id}}},
+				{Key: "updateDescription", Value: bson.D{
+					{Key: "updatedFields", Value: bson.D{{Key: "email", Value: "b@x.io"}}},
+					{Key: "removedFields", Value: bson.A{"name"}},
+				}},
+				{Key: "fullDocument", Value: bson.D{{Key: "_id", Value: id}, {Key: "email", Value: "b@x.io"}}},
+			},
+			bson.D{
+				{Key: "_id", Value: resumeToken("3")},
+				{Key: "operationType", Value: "delete"},
+				{Key: "documentKey", Value: bson.D{{Key: "_id", Value: id}}},
+			},
+		))
+
+		store := memoryTokenStore{}
+		ctx := context.Background()
+
+		stream, err := coll.Watch(ctx, nil, &mgm.WatchOptions{Model: &Ticket{}, Store: store, Name: "tickets"})
+		util.AssertErrIsNil(t, err)
+		defer stream.Close(ctx)
+
+		stage := mt.GetStartedEvent().Command.Lookup("pipeline").Array().Index(0).Value().Document()
+		require.Equal(t, "updateLookup", stage.Lookup("$changeStream", "fullDocument").StringValue())
+
+		require.True(t, stream.Next(ctx))
+		ev := stream.Event()
+		require.Equal(t, mgm.ChangeInsert, ev.Op)
+		require.Equal(t, id, ev.DocumentKey["_id"])
+		require.Equal(t, "a@x.io", ev.Model.(*Ticket).Email)
+		require.Nil(t, store["tickets"])
+
+		require.True(t, stream.Next(ctx))
+		ev = stream.Event()
+		require.Equal(t, mgm.ChangeUpdate, ev.Op)
+		require.Equal(t, "b@x.io", ev.UpdatedFields["email"])
+		require.Equal(t, []string{"name"}, ev.RemovedFields)
+		require.Equal(t, "b@x.io", ev.Model.(*Ticket).Email)
+		require.Equal(t, "1", store["tickets"].Lookup("_data").StringValue())
+
+		require.True(t, stream.Next(ctx))
+		ev = stream.Event()
+		require.Equal(t, mgm.ChangeDelete, ev.Op)
+		require.Nil(t, ev.Model)
+
+		util.AssertErrIsNil(t, stream.Checkpoint(ctx))
+		require.Equal(t, "3", store["tickets"].Lookup("_data").StringValue())
+	})
+}
+
+func TestWatchResumesFromStore(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(1, "models."+coll.Name(), mtest.FirstBatch))
+
+		token, err := bson.Marshal(resumeToken("7"))
+		util.AssertErrIsNil(t, err)
+		store := memoryTokenStore{coll.Name(): token}
+
+		stream, err := coll.Watch(context.Background(), nil, &mgm.WatchOptions{Store: store})
+		util.AssertErrIsNil(t, err)
+		defer stream.Close(context.Background())
+
+		stage := mt.GetStartedEvent().Command.Lookup("pipeline").Array().Index(0).Value().Document()
+		require.Equal(t, "7", stage.Lookup("$changeStream", "resumeAfter", "_data").StringValue())
+		require.Equal(t, "default", stage.Lookup("$changeStream", "fullDocument").StringValue())
+	})
+}
+
+func TestWatchReconnects(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		ns := "models." + coll.Name()
+		event := func(token string) bson.D {
+			return bson.D{{Key: "_id", Value: resumeToken(token)}, {Key: "operationType", Value: "insert"}}
+		}
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, ns, mtest.FirstBatch, event("1")),
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 2, Message: "failed"}),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateCursorResponse(1, ns, mtest.FirstBatch, event("2")),
+		)
+
+		ctx := context.Background()
+		stream, err := coll.Watch(ctx, nil, &mgm.WatchOptions{Backoff: time.Millisecond, MaxRetries: 1})
+		util.AssertErrIsNil(t, err)
+		defer stream.Close(ctx)
+
+		require.True(t, stream.Next(ctx))
+		require.True(t, stream.Next(ctx))
+		require.Equal(t, "2", stream.Event().ResumeToken.Lookup("_data").StringValue())
+
+		var resumeAfter string
+		for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+			if evt.CommandName == "aggregate" {
+				stage := evt.Command.Lookup("pipeline").Array().Index(0).Value().Document()
+				if v, err := stage.LookupErr("$changeStream", "resumeAfter", "_data"); err == nil {
+					resumeAfter = v.StringValue()
+				}
+			}
+		}
+		require.Equal(t, "1", resumeAfter)
+
+		require.False(t, stream.Next(ctx))
+		require.Error(t, stream.Err())
+	})
+}
+
+// emptyStreamResponse returns the response of a change stream without events,
+// whose post-batch resume token is the token.
+func emptyStreamResponse(ns, token string) bson.D {
+	return bson.D{
+		{Key: "ok", Value: 1},
+		{Key: "cursor", Value: bson.D{
+			{Key: "id", Value: int64(1)},
+			{Key: "ns", Value: ns},
+			{Key: "firstBatch", Value: bson.A{}},
+			{Key: "postBatchResumeToken", Value: resumeToken(token)},
+		}},
+	}
+}
+
+func TestWatchReconnectsWithoutEvents(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		ns := "models." + coll.Name()
+
+		mt.AddMockResponses(
+			emptyStreamResponse(ns, "9"),
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 2, Message: "failed"}),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateCursorResponse(1, ns, mtest.FirstBatch, bson.D{{Key: "_id", Value: resumeToken("10")}, {Key: "operationType", Value: "insert"}}),
+		)
+
+		ctx := context.Background()
+		stream, err := coll.Watch(ctx, nil, &mgm.WatchOptions{Backoff: time.Millisecond, MaxRetries: 1})
+		util.AssertErrIsNil(t, err)
+		defer stream.Close(ctx)
+
+		require.True(t, stream.Next(ctx))
+		require.Equal(t, "10", stream.Event().ResumeToken.Lookup("_data").StringValue())
+
+		var resumeAfter string
+		for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+			if evt.CommandName == "aggregate" {
+				stage := evt.Command.Lookup("pipeline").Array().Index(0).Value().Document()
+				if v, err := stage.LookupErr("$changeStream", "resumeAfter", "_data"); err == nil {
+					resumeAfter = v.StringValue()
+				}
+			}
+		}
+		require.Equal(t, "9", resumeAfter)
+	})
+}
+
+func TestWatchStopsOnHistoryLost(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(
+			emptyStreamResponse("models."+coll.Name(), "9"),
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 286, Name: "ChangeStreamHistoryLost", Message: "history lost"}),
+		)
+
+		ctx := context.Background()
+		stream, err := coll.Watch(ctx, nil, &mgm.WatchOptions{Backoff: time.Millisecond})
+		util.AssertErrIsNil(t, err)
+		defer stream.Close(ctx)
+
+		require.False(t, stream.Next(ctx))
+
+		var serverErr mongo.ServerError
+		require.True(t, errors.As(stream.Err(), &serverErr))
+		require.True(t, serverErr.HasErrorCode(286))
+
+		require.Equal(t, "aggregate", mt.GetStartedEvent().CommandName)
+		require.Equal(t, "getMore", mt.GetStartedEvent().CommandName)
+		require.Nil(t, mt.GetStartedEvent())
+	})
+}
+
+func TestCollectionTokenStore(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		raw, err := bson.Marshal(resumeToken("1"))
+		util.AssertErrIsNil(t, err)
+		token := bson.Raw(raw)
+
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateCursorResponse(0, "models."+coll.Name(), mtest.FirstBatch, bson.D{{Key: "_id", Value: "tickets"}, {Key: "token", Value: token}}),
+			mtest.CreateCursorResponse(0, "models."+coll.Name(), mtest.FirstBatch),
+		)
+
+		store := mgm.NewCollectionTokenStore(coll)
+		ctx := context.Background()
+
+		util.AssertErrIsNil(t, store.SaveResumeToken(ctx, "tickets", token))
+		upd := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		require.Equal(t, "tickets", upd.Lookup("q", "_id").StringValue())
+		require.True(t, upd.Lookup("upsert").Boolean())
+
+		loaded, err := store.LoadResumeToken(ctx, "tickets")
+		util.AssertErrIsNil(t, err)
+		require.Equal(t, token, loaded)
+
+		loaded, err = store.LoadResumeToken(ctx, "orders")
+		util.AssertErrIsNil(t, err)
+		require.Nil(t, loaded)
+	})
+}
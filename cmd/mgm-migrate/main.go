@@ -0,0 +1,63 @@
+// Command mgm-migrate applies, reverts and reports the migrations
+// registered by the `migrate.Register` function.
+//
+// Migrations are Go code, so copy this command into your project and
+// import your migrations' package for its side effects:
+//
+//	import _ "example.com/project/migrations"
+//
+// Usage:
+//
+//	mgm-migrate -uri mongodb://localhost:27017 -db mydb up|down [steps]|status
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/uncle-gua/mgm"
+	"github.com/uncle-gua/mgm/migrate"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func main() {
+	uri := flag.String("uri", "mongodb://localhost:27017", "mongodb connection uri")
+	dbName := flag.String("db", "", "database name")
+	timeout := flag.Duration("timeout", 10*time.Minute, "timeout of the command")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] command\n\nflags:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintln(flag.CommandLine.Output(), migrate.Usage)
+	}
+	flag.Parse()
+
+	if *dbName == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*uri, *dbName, *timeout, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(uri, dbName string, timeout time.Duration, args []string) error {
+	if err := mgm.SetDefaultConfig(nil, dbName, options.Client().ApplyURI(uri)); err != nil {
+		return err
+	}
+
+	m, err := migrate.Default()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return migrate.Run(ctx, m, args, os.Stdout)
+}
@@ -13,13 +13,29 @@ import (
 // Collection performs operations on models and the given Mongodb collection
 type Collection struct {
 	c *mongo.Collection
+
+	// conn is the connection the collection belongs to, nil for
+	// collections that are created by NewCollection.
+	conn *Connection
+	opts []*options.CollectionOptions
+
+	// session is the session the collection's operations use, see InSession.
+	session mongo.Session
+
+	// softDelete is true when the collection's model supports soft delete.
+	softDelete bool
+	trashed    trashedScope
+
+	// recorded is true when the changes of the collection's model are
+	// recorded, i.e it's auditable or revisioned.
+	recorded bool
 }
 
 // FindByID method finds a doc and decodes it to a model, otherwise returns an error.
 // The id field can be any value that if passed to the `PrepareID` method, it returns
 // a valid ID (e.g string, bson.ObjectId).
 func (coll *Collection) FindByID(id interface{}, model Model, opts ...*options.FindOneOptions) error {
-	ctx, cancel := ctx()
+	ctx, cancel := coll.ctx()
 	defer cancel()
 
 	return coll.FindByIDWithCtx(ctx, id, model, opts...)
@@ -40,7 +56,7 @@ func (coll *Collection) FindByIDWithCtx(ctx context.Context, id interface{}, mod
 
 // First method searches and returns the first document in the search results.
 func (coll *Collection) First(filter interface{}, model Model, opts ...*options.FindOneOptions) error {
-	ctx, cancel := ctx()
+	ctx, cancel := coll.ctx()
 	defer cancel()
 
 	return coll.FirstWithCtx(ctx, filter, model, opts...)
@@ -53,7 +69,7 @@ func (coll *Collection) FirstWithCtx(ctx context.Context, filter interface{}, mo
 
 // Create method inserts a new model into the database.
 func (coll *Collection) Create(model Model, opts ...*options.InsertOneOptions) error {
-	ctx, cancel := ctx()
+	ctx, cancel := coll.ctx()
 	defer cancel()
 
 	return coll.CreateWithCtx(ctx, model, opts...)
@@ -68,7 +84,7 @@ func (coll *Collection) CreateWithCtx(ctx context.Context, model Model, opts ...
 // Calling this method also invokes the model's mgm updating, updated,
 // saving, and saved hooks.
 func (coll *Collection) Update(model Model, opts ...*options.UpdateOptions) error {
-	ctx, cancel := ctx()
+	ctx, cancel := coll.ctx()
 	defer cancel()
 
 	return coll.UpdateWithCtx(ctx, model, opts...)
@@ -85,7 +101,7 @@ func (coll *Collection) UpdateWithCtx(ctx context.Context, model Model, opts ...
 // Calling this method also invokes the model's mgm updating, updated,
 // saving, and saved hooks.
 func (coll *Collection) UpdateByID(id interface{}, model Model, opts ...*options.UpdateOptions) error {
-	ctx, cancel := ctx()
+	ctx, cancel := coll.ctx()
 	defer cancel()
 
 	return coll.UpdateByIDWithCtx(ctx, id, model, opts...)
@@ -105,11 +121,30 @@ func (coll *Collection) UpdateByIDWithCtx(ctx context.Context, id interface{}, m
 	return update(ctx, coll, model, opts...)
 }
 
+// Replace method replaces the model's document with the whole model, so
+// fields that the model does not contain are removed from the document.
+// Calling this method also invokes the model's mgm updating, updated,
+// saving, and saved hooks.
+func (coll *Collection) Replace(model Model, opts ...*options.ReplaceOptions) error {
+	ctx, cancel := coll.ctx()
+	defer cancel()
+
+	return coll.ReplaceWithCtx(ctx, model, opts...)
+}
+
+// ReplaceWithCtx method replaces the model's document with the whole model using the specified context.
+// Calling this method also invokes the model's mgm updating, updated,
+// saving, and saved hooks.
+func (coll *Collection) ReplaceWithCtx(ctx context.Context, model Model, opts ...*options.ReplaceOptions) error {
+	return replace(ctx, coll, model, opts...)
+}
+
 // Delete method deletes a model (doc) from a collection.
+// Models that implement SoftDeletable are soft deleted.
 // To perform additional operations when deleting a model
 // you should use hooks rather than overriding this method.
 func (coll *Collection) Delete(model Model) error {
-	ctx, cancel := ctx()
+	ctx, cancel := coll.ctx()
 	defer cancel()
 
 	return del(ctx, coll, model)
@@ -120,73 +155,175 @@ func (coll *Collection) Name() string {
 	return coll.c.Name()
 }
 
+// Database method returns the collection's database.
+func (coll *Collection) Database() *mongo.Database {
+	return coll.c.Database()
+}
+
 func (coll *Collection) CountDocuments(filter interface{}, opts ...*options.CountOptions) (int64, error) {
-	ctx, cancel := ctx()
+	ctx, cancel := coll.ctx()
 	defer cancel()
 
 	return coll.CountDocumentsWithCtx(ctx, filter, opts...)
 }
 
 func (coll *Collection) CountDocumentsWithCtx(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error) {
-	return coll.c.CountDocuments(ctx, filter, opts...)
+	var count int64
+	op := &OpInfo{Op: OpCount, Filter: coll.scopeFilter(filter), Options: opts}
+
+	err := coll.intercept(ctx, op, func(ctx context.Context, op *OpInfo) (err error) {
+		opts, err := opOptions[*options.CountOptions](op)
+		if err != nil {
+			return err
+		}
+
+		count, err = coll.collection(ctx).CountDocuments(ctx, op.Filter, opts...)
+		return err
+	})
+
+	return count, err
 }
 
 func (coll *Collection) Find(filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
-	ctx, cancel := ctx()
+	ctx, cancel := coll.ctx()
 	defer cancel()
 
 	return coll.FindWithCtx(ctx, filter, opts...)
 }
 
 func (coll *Collection) FindWithCtx(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
-	return coll.c.Find(ctx, filter)
+	var cur *mongo.Cursor
+	op := &OpInfo{Op: OpFind, Filter: filter, Options: opts}
+
+	err := coll.intercept(ctx, op, func(ctx context.Context, op *OpInfo) (err error) {
+		opts, err := opOptions[*options.FindOptions](op)
+		if err != nil {
+			return err
+		}
+
+		cur, err = coll.collection(ctx).Find(ctx, op.Filter, opts...)
+		return err
+	})
+
+	return cur, err
 }
 
 func (coll *Collection) DeleteMany(filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
-	ctx, cancel := ctx()
+	ctx, cancel := coll.ctx()
 	defer cancel()
 
 	return coll.DeleteManyCtx(ctx, filter, opts...)
 }
 
 func (coll *Collection) DeleteManyCtx(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
-	return coll.c.DeleteMany(ctx, filter)
+	var res *mongo.DeleteResult
+	op := &OpInfo{Op: OpDeleteMany, Filter: filter, Options: opts}
+
+	err := coll.intercept(ctx, op, func(ctx context.Context, op *OpInfo) (err error) {
+		opts, err := opOptions[*options.DeleteOptions](op)
+		if err != nil {
+			return err
+		}
+
+		res, err = coll.collection(ctx).DeleteMany(ctx, op.Filter, opts...)
+		return err
+	})
+
+	return res, err
 }
 
 func (coll *Collection) InsertMany(documents []interface{}, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error) {
-	ctx, cancel := ctx()
+	ctx, cancel := coll.ctx()
 	defer cancel()
 
 	return coll.InsertManyCtx(ctx, documents, opts...)
 }
 
 func (coll *Collection) InsertManyCtx(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error) {
-	return coll.c.InsertMany(ctx, documents, opts...)
+	var res *mongo.InsertManyResult
+	op := &OpInfo{Op: OpInsertMany, Documents: documents, Options: opts}
+
+	err := coll.intercept(ctx, op, func(ctx context.Context, op *OpInfo) (err error) {
+		opts, err := opOptions[*options.InsertManyOptions](op)
+		if err != nil {
+			return err
+		}
+
+		res, err = coll.collection(ctx).InsertMany(ctx, op.Documents, opts...)
+		return err
+	})
+
+	return res, err
 }
 
 func (coll *Collection) FindOne(filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
-	ctx, cancel := ctx()
+	ctx, cancel := coll.ctx()
 	defer cancel()
 
 	return coll.FindOneWithCtx(ctx, filter, opts...)
 }
 
+// FindOneWithCtx finds a document using the specified context. If the operation
+// is rejected (e.g by an interceptor or in the strict sessions mode), the result's
+// error is a mongo.MarshalError whose Err field is the rejection's error.
 func (coll *Collection) FindOneWithCtx(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
-	return coll.c.FindOne(ctx, filter, opts...)
+	var res *mongo.SingleResult
+	op := &OpInfo{Op: OpFirst, Filter: filter, Options: opts}
+
+	err := coll.intercept(ctx, op, func(ctx context.Context, op *OpInfo) error {
+		opts, err := opOptions[*options.FindOneOptions](op)
+		if err != nil {
+			return err
+		}
+
+		res = coll.collection(ctx).FindOne(ctx, op.Filter, opts...)
+		return res.Err()
+	})
+
+	if res == nil || err != nil && err != res.Err() {
+		// The driver's results can't be created with an error, but a
+		// filter that fails to marshal fails before any command is sent.
+		return coll.collection(ctx).FindOne(ctx, rejectedFilter{err: err})
+	}
+
+	return res
+}
+
+// rejectedFilter is the filter of rejected FindOne operations.
+type rejectedFilter struct {
+	err error
+}
+
+func (f rejectedFilter) MarshalBSON() ([]byte, error) {
+	return nil, f.err
 }
 
 func (coll *Collection) Aggregate(pipeline interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
-	ctx, cancel := ctx()
+	ctx, cancel := coll.ctx()
 	defer cancel()
 
 	return coll.AggregateWithCtx(ctx, pipeline, opts...)
 }
 
 func (coll *Collection) AggregateWithCtx(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
-	return coll.c.Aggregate(ctx, pipeline, opts...)
+	var cur *mongo.Cursor
+	op := &OpInfo{Op: OpAggregate, Filter: pipeline, Options: opts}
+
+	err := coll.intercept(ctx, op, func(ctx context.Context, op *OpInfo) (err error) {
+		opts, err := opOptions[*options.AggregateOptions](op)
+		if err != nil {
+			return err
+		}
+
+		cur, err = coll.collection(ctx).Aggregate(ctx, op.Filter, opts...)
+		return err
+	})
+
+	return cur, err
 }
 
 // DeleteWithCtx method deletes a model (doc) from a collection using the specified context.
+// Models that implement SoftDeletable are soft deleted.
 // To perform additional operations when deleting a model
 // you should use hooks rather than overriding this method.
 func (coll *Collection) DeleteWithCtx(ctx context.Context, model Model) error {
@@ -195,7 +332,7 @@ func (coll *Collection) DeleteWithCtx(ctx context.Context, model Model) error {
 
 // SimpleFind finds, decodes and returns the results.
 func (coll *Collection) SimpleFind(results interface{}, filter interface{}, opts ...*options.FindOptions) error {
-	ctx, cancel := ctx()
+	ctx, cancel := coll.ctx()
 	defer cancel()
 
 	return coll.SimpleFindWithCtx(ctx, results, filter, opts...)
@@ -203,13 +340,17 @@ func (coll *Collection) SimpleFind(results interface{}, filter interface{}, opts
 
 // SimpleFindWithCtx finds, decodes and returns the results using the specified context.
 func (coll *Collection) SimpleFindWithCtx(ctx context.Context, results interface{}, filter interface{}, opts ...*options.FindOptions) error {
-	cur, err := coll.c.Find(ctx, filter, opts...)
+	cur, err := coll.FindWithCtx(ctx, coll.forResults(results).scopeFilter(filter), opts...)
 
 	if err != nil {
 		return err
 	}
 
-	return cur.All(ctx, results)
+	if err := decodeResults(ctx, cur, results); err != nil {
+		return err
+	}
+
+	return callToFoundHooksOfResults(ctx, results)
 }
 
 //--------------------------------
@@ -218,7 +359,7 @@ func (coll *Collection) SimpleFindWithCtx(ctx context.Context, results interface
 
 // SimpleAggregateFirst is just same as SimpleAggregateFirstWithCtx, but doesn't get context param.
 func (coll *Collection) SimpleAggregateFirst(result interface{}, stages ...interface{}) (bool, error) {
-	ctx, cancel := ctx()
+	ctx, cancel := coll.ctx()
 	defer cancel()
 
 	return coll.SimpleAggregateFirstWithCtx(ctx, result, stages...)
@@ -229,19 +370,40 @@ func (coll *Collection) SimpleAggregateFirst(result interface{}, stages ...inter
 // Note: you can not use this method in a transaction because it does not accept a context.
 // To participate in transactions, please use the regular aggregation method.
 func (coll *Collection) SimpleAggregateFirstWithCtx(ctx context.Context, result interface{}, stages ...interface{}) (bool, error) {
-	cur, err := coll.SimpleAggregateCursorWithCtx(ctx, stages...)
+	return coll.SimpleAggregateFirstWithOptions(ctx, result, nil, stages...)
+}
+
+// SimpleAggregateFirstWithOptions is just same as SimpleAggregateFirstWithCtx, but
+// passes the provided aggregate options to the driver.
+func (coll *Collection) SimpleAggregateFirstWithOptions(ctx context.Context, result interface{}, opts *options.AggregateOptions, stages ...interface{}) (bool, error) {
+	if model, ok := result.(Model); ok {
+		if err := callToFindingHooks(ctx, model); err != nil {
+			return false, err
+		}
+
+		coll = coll.forModel(model)
+	}
+
+	cur, err := coll.SimpleAggregateCursorWithOptions(ctx, opts, stages...)
 	if err != nil {
 		return false, err
 	}
 	if cur.Next(ctx) {
-		return true, cur.Decode(result)
+		if err := cur.Decode(result); err != nil {
+			return true, err
+		}
+
+		if model, ok := result.(Model); ok {
+			return true, callToFoundHooks(ctx, model)
+		}
+		return true, nil
 	}
 	return false, nil
 }
 
 // SimpleAggregate is just same as SimpleAggregateWithCtx, but doesn't get context param.
 func (coll *Collection) SimpleAggregate(results interface{}, stages ...interface{}) error {
-	ctx, cancel := ctx()
+	ctx, cancel := coll.ctx()
 	defer cancel()
 
 	return coll.SimpleAggregateWithCtx(ctx, results, stages...)
@@ -252,18 +414,28 @@ func (coll *Collection) SimpleAggregate(results interface{}, stages ...interface
 // Note: you can not use this method in a transaction because it does not accept a context.
 // To participate in transactions, please use the regular aggregation method.
 func (coll *Collection) SimpleAggregateWithCtx(ctx context.Context, results interface{}, stages ...interface{}) error {
-	cur, err := coll.SimpleAggregateCursorWithCtx(ctx, stages...)
+	return coll.SimpleAggregateWithOptions(ctx, results, nil, stages...)
+}
+
+// SimpleAggregateWithOptions is just same as SimpleAggregateWithCtx, but
+// passes the provided aggregate options (e.g AllowDiskUse, Collation, MaxTime) to the driver.
+func (coll *Collection) SimpleAggregateWithOptions(ctx context.Context, results interface{}, opts *options.AggregateOptions, stages ...interface{}) error {
+	cur, err := coll.forResults(results).SimpleAggregateCursorWithOptions(ctx, opts, stages...)
 	if err != nil {
 		return err
 	}
 
-	return cur.All(ctx, results)
+	if err := decodeResults(ctx, cur, results); err != nil {
+		return err
+	}
+
+	return callToFoundHooksOfResults(ctx, results)
 }
 
 // SimpleAggregateCursor is just same as SimpleAggregateCursorWithCtx, but
 // doesn't get context.
 func (coll *Collection) SimpleAggregateCursor(stages ...interface{}) (*mongo.Cursor, error) {
-	ctx, cancel := ctx()
+	ctx, cancel := coll.ctx()
 	defer cancel()
 
 	return coll.SimpleAggregateCursorWithCtx(ctx, stages...)
@@ -273,9 +445,15 @@ func (coll *Collection) SimpleAggregateCursor(stages ...interface{}) (*mongo.Cur
 // Note: you can not use this method in a transaction because it does not accept a context.
 // To participate in transactions, please use the regular aggregation method.
 func (coll *Collection) SimpleAggregateCursorWithCtx(ctx context.Context, stages ...interface{}) (*mongo.Cursor, error) {
+	return coll.SimpleAggregateCursorWithOptions(ctx, nil, stages...)
+}
+
+// SimpleAggregateCursorWithOptions is just same as SimpleAggregateCursorWithCtx, but
+// passes the provided aggregate options to the driver.
+func (coll *Collection) SimpleAggregateCursorWithOptions(ctx context.Context, opts *options.AggregateOptions, stages ...interface{}) (*mongo.Cursor, error) {
 	pipeline := bson.A{}
 
-	for _, stage := range stages {
+	for _, stage := range coll.scopeStages(stages) {
 		if operator, ok := stage.(builder.Operator); ok {
 			pipeline = append(pipeline, builder.S(operator))
 		} else {
@@ -283,5 +461,5 @@ func (coll *Collection) SimpleAggregateCursorWithCtx(ctx context.Context, stages
 		}
 	}
 
-	return coll.c.Aggregate(ctx, pipeline, nil)
+	return coll.AggregateWithCtx(ctx, pipeline, opts)
 }
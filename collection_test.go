@@ -1,7 +1,9 @@
 package mgm_test
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -11,6 +13,8 @@ import (
 	"github.com/uncle-gua/mgm/operator"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func TestFindByIdWithInvalidId(t *testing.T) {
@@ -196,3 +200,67 @@ func TestCollection_SimpleAggregate(t *testing.T) {
 		}
 	}
 }
+
+func TestCollection_FindWithCtxPassesOptions(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch))
+
+		opts := options.Find().SetSort(bson.M{"age": -1}).SetLimit(2)
+		cur, err := coll.FindWithCtx(context.Background(), bson.M{}, opts)
+		util.AssertErrIsNil(t, err)
+		util.AssertErrIsNil(t, cur.Close(context.Background()))
+
+		evt := mt.GetStartedEvent()
+		require.Equal(t, "find", evt.CommandName)
+		require.Equal(t, int64(-1), evt.Command.Lookup("sort", "age").AsInt64())
+		require.Equal(t, int64(2), evt.Command.Lookup("limit").AsInt64())
+	})
+}
+
+func TestCollection_DeleteManyCtxPassesOptions(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}))
+
+		opts := options.Delete().SetHint("age_1")
+		_, err := coll.DeleteManyCtx(context.Background(), bson.M{}, opts)
+		util.AssertErrIsNil(t, err)
+
+		deletes := mt.GetStartedEvent().Command.Lookup("deletes").Array()
+		require.Equal(t, "age_1", deletes.Index(0).Value().Document().Lookup("hint").StringValue())
+	})
+}
+
+func TestCollection_SimpleAggregateWithOptions(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch))
+
+		opts := options.Aggregate().
+			SetAllowDiskUse(true).
+			SetMaxTime(2 * time.Second).
+			SetCollation(&options.Collation{Locale: "en"})
+
+		var results []Doc
+		err := coll.SimpleAggregateWithOptions(context.Background(), &results, opts, builder.Group("$_id", nil))
+		util.AssertErrIsNil(t, err)
+
+		cmd := mt.GetStartedEvent().Command
+		require.True(t, cmd.Lookup("allowDiskUse").Boolean())
+		require.Equal(t, int64(2000), cmd.Lookup("maxTimeMS").AsInt64())
+		require.Equal(t, "en", cmd.Lookup("collation", "locale").StringValue())
+	})
+}
+
+func TestCollection_SimpleAggregateFirstWithOptions(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch,
+			bson.D{{Key: "name", Value: "Ali"}}))
+
+		doc := &Doc{}
+		found, err := coll.SimpleAggregateFirstWithOptions(context.Background(), doc, options.Aggregate().SetAllowDiskUse(true))
+		util.AssertErrIsNil(t, err)
+
+		require.True(t, found)
+		require.Equal(t, "Ali", doc.Name)
+		require.True(t, mt.GetStartedEvent().Command.Lookup("allowDiskUse").Boolean())
+	})
+}
@@ -3,6 +3,9 @@ package mgm
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/uncle-gua/mgm/internal/util"
@@ -10,14 +13,32 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var config *Config
-var client *mongo.Client
-var db *mongo.Database
-
 // Config struct contains extra configuration properties for the mgm package.
 type Config struct {
 	// Set to 10 second (10*time.Second) for example.
 	CtxTimeout time.Duration
+
+	// TenantResolver returns the tenant of a context. The tenant is the name of
+	// the tenant's database, or the prefix of its collections when using the
+	// TenantCollectionPrefix strategy. Contexts without a tenant use the
+	// connection's database. Defaults to the tenant set by WithTenant.
+	TenantResolver TenantResolver
+	// TenantStrategy determines how a tenant's collections are stored.
+	TenantStrategy TenantStrategy
+
+	// StrictSessions makes the connection's operations fail with ErrOutsideTransaction
+	// when they're called without a session while a transaction that is started by mgm
+	// with the connection's client is running, e.g when a transaction function forgets
+	// to pass its context to a `...WithCtx` method. Operations are checked in every
+	// goroutine, including the goroutines that don't belong to the transaction, so use
+	// it for connections whose operations all run in transactions while one is running
+	// (e.g workers), and register another connection of the client for the others.
+	// Bind the collections used by the goroutines of a transaction using InSession.
+	StrictSessions bool
+
+	// ActorResolver returns the actor of a context, which is recorded in the audit
+	// records of auditable models. Defaults to the actor set by WithActor.
+	ActorResolver ActorResolver
 }
 
 // NewCtx function creates and returns a new context with the specified timeout.
@@ -32,7 +53,7 @@ func Ctx() (context.Context, context.CancelFunc) {
 }
 
 func ctx() (context.Context, context.CancelFunc) {
-	return NewCtx(config.CtxTimeout)
+	return NewCtx(defaultConnection().config.CtxTimeout)
 }
 
 // NewClient returns a new mongodb client.
@@ -61,47 +82,227 @@ func NewCollection(db *mongo.Database, name string, opts ...*options.CollectionO
 
 // ResetDefaultConfig resets the configuration values, client and database.
 func ResetDefaultConfig() {
-	config = nil
-	client = nil
-	db = nil
+	RemoveConnection(DefaultConnectionName)
 }
 
 // SetDefaultConfig initializes the client and database using the specified configuration values, or default.
-func SetDefaultConfig(conf *Config, dbName string, opts ...*options.ClientOptions) (err error) {
+// The default config becomes the "default" connection.
+func SetDefaultConfig(conf *Config, dbName string, opts ...*options.ClientOptions) error {
+	_, err := AddConnection(DefaultConnectionName, conf, dbName, opts...)
+	return err
+}
+
+// CollectionByName returns a new collection using the current configuration values.
+func CollectionByName(name string, opts ...*options.CollectionOptions) *Collection {
+	return defaultConnection().CollectionByName(name, opts...)
+}
+
+// DefaultConfigs returns the current configuration values, client and database.
+func DefaultConfigs() (*Config, *mongo.Client, *mongo.Database, error) {
+	conn := defaultConnection()
+	if conn == nil || util.AnyNil(conn.config, conn.client, conn.db) {
+		return nil, nil, nil, errors.New("please setup default config before acquiring it")
+	}
+
+	return conn.config, conn.client, conn.db, nil
+}
+
+// defaultConf are the default configuration values when none are provided
+// to the `SetDefaultConfig` method.
+func defaultConf() *Config {
+	return &Config{CtxTimeout: 10 * time.Second}
+}
+
+// DefaultConnectionName is the name of the connection that is
+// initialized by SetDefaultConfig.
+const DefaultConnectionName = "default"
+
+var connections = map[string]*Connection{}
+var connectionsMu sync.RWMutex
 
+// Connection contains the configuration values, client and database of
+// a named connection. Use it to talk to multiple clusters or databases
+// from the same process.
+type Connection struct {
+	name   string
+	config *Config
+	client *mongo.Client
+	db     *mongo.Database
+
+	// tenantColls caches the tenants' collections.
+	tenantColls sync.Map
+}
+
+// NewConnection returns a new connection that uses the specified client and database.
+// Register it using RegisterConnection to make it available by its name.
+func NewConnection(name string, conf *Config, client *mongo.Client, dbName string) *Connection {
 	// Use the predefined configuration values as default if the user
 	// does not provide any.
 	if conf == nil {
 		conf = defaultConf()
 	}
 
-	config = conf
+	return &Connection{name: name, config: conf, client: client, db: client.Database(dbName)}
+}
 
-	if client, err = NewClient(opts...); err != nil {
-		return err
+// AddConnection creates a new client using the specified configuration values (or default)
+// and client options, then registers its connection with the specified name.
+func AddConnection(name string, conf *Config, dbName string, opts ...*options.ClientOptions) (*Connection, error) {
+	if conf == nil {
+		conf = defaultConf()
 	}
 
-	db = client.Database(dbName)
+	client, err := mongo.NewClient(opts...)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	ctx, cancel := NewCtx(conf.CtxTimeout)
+	defer cancel()
+
+	if err = client.Connect(ctx); err != nil {
+		return nil, err
+	}
+
+	conn := NewConnection(name, conf, client, dbName)
+	RegisterConnection(conn)
+
+	return conn, nil
 }
 
-// CollectionByName returns a new collection using the current configuration values.
-func CollectionByName(name string, opts ...*options.CollectionOptions) *Collection {
-	return NewCollection(db, name, opts...)
+// RegisterConnection registers the connection by its name, replacing any
+// connection with the same name.
+func RegisterConnection(conn *Connection) {
+	connectionsMu.Lock()
+	defer connectionsMu.Unlock()
+
+	connections[conn.name] = conn
 }
 
-// DefaultConfigs returns the current configuration values, client and database.
-func DefaultConfigs() (*Config, *mongo.Client, *mongo.Database, error) {
-	if util.AnyNil(config, client, db) {
-		return nil, nil, nil, errors.New("please setup default config before acquiring it")
+// RemoveConnection removes the connection with the specified name from the registry.
+// Note: this function does not disconnect the connection's client.
+func RemoveConnection(name string) {
+	connectionsMu.Lock()
+	defer connectionsMu.Unlock()
+
+	delete(connections, name)
+}
+
+// LookupConnection returns the registered connection with the specified name.
+func LookupConnection(name string) (*Connection, bool) {
+	connectionsMu.RLock()
+	defer connectionsMu.RUnlock()
+
+	conn, ok := connections[name]
+	return conn, ok
+}
+
+// Use returns the registered connection with the specified name, e.g Use("analytics").
+// It panics if the connection is not registered.
+func Use(name string) *Connection {
+	conn, ok := LookupConnection(name)
+	if !ok {
+		panic(fmt.Sprintf("mgm: connection %q is not registered", name))
 	}
 
-	return config, client, db, nil
+	return conn
 }
 
-// defaultConf are the default configuration values when none are provided
-// to the `SetDefaultConfig` method.
-func defaultConf() *Config {
-	return &Config{CtxTimeout: 10 * time.Second}
+func defaultConnection() *Connection {
+	conn, _ := LookupConnection(DefaultConnectionName)
+	return conn
+}
+
+// clientConnection returns the registered connection that has the client (the
+// default connection first), or nil if there is no such connection.
+func clientConnection(client *mongo.Client) *Connection {
+	connectionsMu.RLock()
+	defer connectionsMu.RUnlock()
+
+	if conn, ok := connections[DefaultConnectionName]; ok && conn.client == client {
+		return conn
+	}
+
+	names := make([]string, 0, len(connections))
+	for name := range connections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if connections[name].client == client {
+			return connections[name]
+		}
+	}
+
+	return nil
+}
+
+// Name returns the connection's name.
+func (conn *Connection) Name() string {
+	return conn.name
+}
+
+// Config returns the connection's configuration values.
+func (conn *Connection) Config() *Config {
+	return conn.config
+}
+
+// Client returns the connection's client.
+func (conn *Connection) Client() *mongo.Client {
+	return conn.client
+}
+
+// Database returns the connection's database.
+func (conn *Connection) Database() *mongo.Database {
+	return conn.db
+}
+
+// Ctx creates and returns a new context with the connection's timeout value.
+func (conn *Connection) Ctx() (context.Context, context.CancelFunc) {
+	return NewCtx(conn.config.CtxTimeout)
+}
+
+// CollectionByName returns a new collection of the connection's database.
+func (conn *Connection) CollectionByName(name string, opts ...*options.CollectionOptions) *Collection {
+	return &Collection{c: conn.db.Collection(name, opts...), conn: conn, opts: opts}
+}
+
+// Coll returns the collection associated with a model on this connection,
+// regardless of the model's connection name.
+func (conn *Connection) Coll(m Model, opts ...*options.CollectionOptions) *Collection {
+	return collOf(m, conn, opts...)
+}
+
+// Transaction creates a transaction with the connection's client.
+func (conn *Connection) Transaction(f TransactionFunc, opts ...*TxOptions) error {
+	ctx, cancel := conn.Ctx()
+	defer cancel()
+
+	return TransactionWithClient(ctx, conn.client, f, opts...)
+}
+
+// TransactionWithCtx creates a transaction with the given context and the connection's client.
+func (conn *Connection) TransactionWithCtx(ctx context.Context, f TransactionFunc, opts ...*TxOptions) error {
+	return TransactionWithClient(ctx, conn.client, f, opts...)
+}
+
+// WithTransaction runs the function in a transaction of the connection's client,
+// see the WithTransaction function.
+func (conn *Connection) WithTransaction(ctx context.Context, f TxFunc, opts ...*TxOptions) error {
+	return withTransaction(ctx, conn.client, f, opts)
+}
+
+// ctx returns a new context with the timeout of the collection's connection.
+func (coll *Collection) ctx() (context.Context, context.CancelFunc) {
+	var c context.Context
+	var cancel context.CancelFunc
+
+	if coll.conn != nil {
+		c, cancel = coll.conn.Ctx()
+	} else {
+		c, cancel = ctx()
+	}
+
+	return coll.sessionCtx(c), cancel
 }
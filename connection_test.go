@@ -2,10 +2,13 @@ package mgm_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/uncle-gua/mgm"
 	"github.com/uncle-gua/mgm/internal/util"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
@@ -95,3 +98,68 @@ func TestGetDefaultConfigAfterSettingItUp(t *testing.T) {
 
 	util.AssertErrIsNil(t, err)
 }
+
+type Event struct {
+	mgm.DefaultModel `bson:",inline"`
+
+	Name string `bson:"name"`
+}
+
+func (e *Event) ConnectionName() string {
+	return "analytics"
+}
+
+func TestNamedConnection(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("mock", func(mt *mtest.T) {
+		conn := mgm.NewConnection("analytics", &mgm.Config{CtxTimeout: time.Minute}, mt.Client, "analytics_db")
+		mgm.RegisterConnection(conn)
+		defer mgm.RemoveConnection("analytics")
+
+		require.Same(t, conn, mgm.Use("analytics"))
+
+		coll := mgm.Coll(&Event{})
+		require.Equal(t, "analytics_db", coll.Database().Name())
+		require.Equal(t, "events", coll.Name())
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		util.AssertErrIsNil(t, coll.Create(&Event{Name: "signup"}))
+		require.Equal(t, "analytics_db", mt.GetStartedEvent().DatabaseName)
+
+		// An explicit connection wins over the model's connection name.
+		other := mgm.NewConnection("other", nil, mt.Client, "other_db")
+		require.Equal(t, "other_db", other.Coll(&Event{}).Database().Name())
+	})
+}
+
+func TestConnectionCtx(t *testing.T) {
+	conn := mgm.NewConnection("timeout", &mgm.Config{CtxTimeout: time.Hour}, &mongo.Client{}, "db")
+
+	ctx, cancel := conn.Ctx()
+	defer cancel()
+
+	deadline, ok := ctx.Deadline()
+	require.True(t, ok)
+	require.True(t, time.Until(deadline) > time.Minute)
+}
+
+func TestUseUnknownConnection(t *testing.T) {
+	_, ok := mgm.LookupConnection("unknown")
+	require.False(t, ok)
+
+	require.Panics(t, func() { mgm.Use("unknown") })
+}
+
+type Click struct {
+	mgm.DefaultModel `bson:",inline"`
+}
+
+func (c *Click) ConnectionName() string {
+	return "unregistered"
+}
+
+func TestCollOfUnknownConnection(t *testing.T) {
+	require.PanicsWithValue(t, `mgm: connection "unregistered" is not registered`, func() { mgm.Coll(&Click{}) })
+}
@@ -3,6 +3,7 @@ package mgm
 import (
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -18,6 +19,30 @@ type DateFields struct {
 	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
 }
 
+// SoftDeleteFields struct contains the `deleted_at` field. Models that
+// embed it are soft deleted: deleting them sets `deleted_at` rather than
+// removing the document.
+type SoftDeleteFields struct {
+	DeletedAt *time.Time `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+}
+
+// VersionField struct contains the `_v` field that is used for optimistic
+// concurrency control when updating a model.
+type VersionField struct {
+	Version int64 `json:"version" bson:"_v"`
+}
+
+// SnapshotField struct keeps the state of a model as it was loaded from
+// the database, so updating the model just sends the changed fields.
+type SnapshotField struct {
+	snapshot bson.Raw
+}
+
+// RevisionFields struct makes a model keep the revisions of its documents:
+// updating or deleting the model copies its stored document into the
+// `<collection>_revisions` collection.
+type RevisionFields struct{}
+
 // PrepareID method prepares the ID value to be used for filtering
 // e.g convert hex-string ID value to bson.ObjectId
 func (f *IDField) PrepareID(id interface{}) (interface{}, error) {
@@ -58,3 +83,60 @@ func (f *DateFields) Saving() error {
 	f.UpdatedAt = time.Now().UTC()
 	return nil
 }
+
+//--------------------------------
+// SoftDeleteFields methods
+//--------------------------------
+
+// GetDeletedAt returns the model's soft delete date, or nil if it's not deleted.
+func (f *SoftDeleteFields) GetDeletedAt() *time.Time {
+	return f.DeletedAt
+}
+
+// SetDeletedAt sets the model's soft delete date.
+func (f *SoftDeleteFields) SetDeletedAt(t *time.Time) {
+	f.DeletedAt = t
+}
+
+// IsDeleted returns true if the model is soft deleted.
+func (f *SoftDeleteFields) IsDeleted() bool {
+	return f.DeletedAt != nil
+}
+
+//--------------------------------
+// VersionField methods
+//--------------------------------
+
+// GetVersion returns the model's version.
+func (f *VersionField) GetVersion() int64 {
+	return f.Version
+}
+
+// SetVersion sets the model's version.
+func (f *VersionField) SetVersion(v int64) {
+	f.Version = v
+}
+
+//--------------------------------
+// RevisionFields methods
+//--------------------------------
+
+// RevisionPolicy returns the retention policy of the model's revisions,
+// which keeps all of them.
+func (f *RevisionFields) RevisionPolicy() RevisionPolicy {
+	return RevisionPolicy{}
+}
+
+//--------------------------------
+// SnapshotField methods
+//--------------------------------
+
+// Snapshot returns the model's document as it was loaded from or saved to the database.
+func (f *SnapshotField) Snapshot() bson.Raw {
+	return f.snapshot
+}
+
+// SetSnapshot sets the model's snapshot.
+func (f *SnapshotField) SetSnapshot(raw bson.Raw) {
+	f.snapshot = raw
+}
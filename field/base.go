@@ -5,6 +5,18 @@ import "go.mongodb.org/mongo-driver/bson"
 // ID field is constant for referencing the "_id" field name.
 const ID = "_id"
 
+// Version field is constant for referencing the optimistic concurrency "_v" field name.
+const Version = "_v"
+
+// CreatedAt field is constant for referencing the "created_at" field name.
+const CreatedAt = "created_at"
+
+// UpdatedAt field is constant for referencing the "updated_at" field name.
+const UpdatedAt = "updated_at"
+
+// DeletedAt field is constant for referencing the soft delete "deleted_at" field name.
+const DeletedAt = "deleted_at"
+
 // Empty is a predefined empty map.
 var Empty = bson.M{}
 
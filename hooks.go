@@ -2,6 +2,8 @@ package mgm
 
 import (
 	"context"
+	"reflect"
+
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -94,6 +96,28 @@ type DeletedHookWithCtx interface {
 	Deleted(ctx context.Context, result *mongo.DeleteResult) error
 }
 
+// FindingHook is called before a model is found
+// Deprecated: Please use FindingHookWithCtx
+type FindingHook interface {
+	Finding() error
+}
+
+// FindingHookWithCtx is called before a model is found
+type FindingHookWithCtx interface {
+	Finding(context.Context) error
+}
+
+// FoundHook is called after a model is found and decoded
+// Deprecated: Please use FoundHookWithCtx
+type FoundHook interface {
+	Found() error
+}
+
+// FoundHookWithCtx is called after a model is found and decoded
+type FoundHookWithCtx interface {
+	Found(context.Context) error
+}
+
 func callToBeforeCreateHooks(ctx context.Context, model Model) error {
 	if hook, ok := model.(CreatingHookWithCtx); ok {
 		if err := hook.Creating(ctx); err != nil {
@@ -115,18 +139,12 @@ func callToBeforeCreateHooks(ctx context.Context, model Model) error {
 		}
 	}
 
-	return nil
+	return validate(ctx, model)
 }
 
 func callToBeforeUpdateHooks(ctx context.Context, model Model) error {
-	if hook, ok := model.(UpdatingHookWithCtx); ok {
-		if err := hook.Updating(ctx); err != nil {
-			return err
-		}
-	} else if hook, ok := model.(UpdatingHook); ok {
-		if err := hook.Updating(); err != nil {
-			return err
-		}
+	if err := callToUpdatingHooks(ctx, model); err != nil {
+		return err
 	}
 
 	if hook, ok := model.(SavingHookWithCtx); ok {
@@ -139,7 +157,7 @@ func callToBeforeUpdateHooks(ctx context.Context, model Model) error {
 		}
 	}
 
-	return nil
+	return validate(ctx, model)
 }
 
 func callToAfterCreateHooks(ctx context.Context, model Model) error {
@@ -167,14 +185,8 @@ func callToAfterCreateHooks(ctx context.Context, model Model) error {
 }
 
 func callToAfterUpdateHooks(ctx context.Context, updateResult *mongo.UpdateResult, model Model) error {
-	if hook, ok := model.(UpdatedHookWithCtx); ok {
-		if err := hook.Updated(ctx, updateResult); err != nil {
-			return err
-		}
-	} else if hook, ok := model.(UpdatedHook); ok {
-		if err := hook.Updated(updateResult); err != nil {
-			return err
-		}
+	if err := callToUpdatedHooks(ctx, updateResult, model); err != nil {
+		return err
 	}
 
 	if hook, ok := model.(SavedHookWithCtx); ok {
@@ -190,6 +202,34 @@ func callToAfterUpdateHooks(ctx context.Context, updateResult *mongo.UpdateResul
 	return nil
 }
 
+func callToUpdatingHooks(ctx context.Context, model Model) error {
+	if hook, ok := model.(UpdatingHookWithCtx); ok {
+		if err := hook.Updating(ctx); err != nil {
+			return err
+		}
+	} else if hook, ok := model.(UpdatingHook); ok {
+		if err := hook.Updating(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func callToUpdatedHooks(ctx context.Context, updateResult *mongo.UpdateResult, model Model) error {
+	if hook, ok := model.(UpdatedHookWithCtx); ok {
+		if err := hook.Updated(ctx, updateResult); err != nil {
+			return err
+		}
+	} else if hook, ok := model.(UpdatedHook); ok {
+		if err := hook.Updated(updateResult); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func callToBeforeDeleteHooks(ctx context.Context, model Model) error {
 	if hook, ok := model.(DeletingHookWithCtx); ok {
 		if err := hook.Deleting(ctx); err != nil {
@@ -217,3 +257,135 @@ func callToAfterDeleteHooks(ctx context.Context, deleteResult *mongo.DeleteResul
 
 	return nil
 }
+
+func callToFindingHooks(ctx context.Context, model Model) error {
+	if hook, ok := model.(FindingHookWithCtx); ok {
+		if err := hook.Finding(ctx); err != nil {
+			return err
+		}
+	} else if hook, ok := model.(FindingHook); ok {
+		if err := hook.Finding(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func callToFoundHooks(ctx context.Context, model Model) error {
+	if hook, ok := model.(FoundHookWithCtx); ok {
+		if err := hook.Found(ctx); err != nil {
+			return err
+		}
+	} else if hook, ok := model.(FoundHook); ok {
+		if err := hook.Found(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var findingHookTypes = []reflect.Type{
+	reflect.TypeOf((*FindingHookWithCtx)(nil)).Elem(),
+	reflect.TypeOf((*FindingHook)(nil)).Elem(),
+}
+
+var foundHookTypes = []reflect.Type{
+	reflect.TypeOf((*FoundHookWithCtx)(nil)).Elem(),
+	reflect.TypeOf((*FoundHook)(nil)).Elem(),
+}
+
+// modelsOf returns the slice of the results if they're a pointer to a slice
+// of models that implement one of the hook types.
+func modelsOf(results interface{}, hookTypes []reflect.Type) (reflect.Value, bool) {
+	v := reflect.ValueOf(results)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return reflect.Value{}, false
+	}
+	v = v.Elem()
+
+	// The hooks are implemented by pointers, so check the elements' pointer type.
+	ptrType := v.Type().Elem()
+	if ptrType.Kind() != reflect.Ptr {
+		ptrType = reflect.PtrTo(ptrType)
+	}
+
+	for _, hookType := range hookTypes {
+		if ptrType.Implements(hookType) {
+			return v, true
+		}
+	}
+
+	return reflect.Value{}, false
+}
+
+// decodeResults decodes the cursor's documents into the results. If the results
+// are a pointer to a slice of models, the finding hooks of each model are called
+// before it's decoded.
+func decodeResults(ctx context.Context, cur *mongo.Cursor, results interface{}) error {
+	v, ok := modelsOf(results, findingHookTypes)
+	if !ok {
+		return cur.All(ctx, results)
+	}
+	defer cur.Close(ctx)
+
+	elemType := v.Type().Elem()
+	list := reflect.MakeSlice(v.Type(), 0, 0)
+
+	for cur.Next(ctx) {
+		var elem, ptr reflect.Value
+		if elemType.Kind() == reflect.Ptr {
+			ptr = reflect.New(elemType.Elem())
+			elem = ptr
+		} else {
+			ptr = reflect.New(elemType)
+			elem = ptr.Elem()
+		}
+
+		if model, ok := ptr.Interface().(Model); ok {
+			if err := callToFindingHooks(ctx, model); err != nil {
+				return err
+			}
+		}
+
+		if err := cur.Decode(ptr.Interface()); err != nil {
+			return err
+		}
+		list = reflect.Append(list, elem)
+	}
+
+	if err := cur.Err(); err != nil {
+		return err
+	}
+
+	v.Set(list)
+	return nil
+}
+
+// callToFoundHooksOfResults calls the found hooks of each model of the
+// results, if the results are a pointer to a slice of models.
+func callToFoundHooksOfResults(ctx context.Context, results interface{}) error {
+	v, ok := modelsOf(results, foundHookTypes)
+	if !ok {
+		return nil
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		elem := v.Index(i)
+		if elem.Kind() != reflect.Ptr {
+			elem = elem.Addr()
+		}
+		if elem.IsNil() {
+			continue
+		}
+
+		if model, ok := elem.Interface().(Model); ok {
+			if err := callToFoundHooks(ctx, model); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/uncle-gua/mgm/internal/util"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
 )
 
 type Person struct {
@@ -500,3 +501,166 @@ func TestDeletingDocHooks_Celebrity(t *testing.T) {
 	count, _ := mgm.Coll(celebrity).CountDocuments(bson.M{})
 	require.Equal(t, count, int64(0), "Expected having no documents,got ", count)
 }
+
+type Note struct {
+	mgm.DefaultModel `bson:",inline"`
+
+	Body     string `bson:"body"`
+	Priority string `bson:"priority"`
+
+	finding int
+	found   int
+}
+
+func (n *Note) Finding(ctx context.Context) error {
+	n.finding++
+	return nil
+}
+
+func (n *Note) Found(ctx context.Context) error {
+	n.found++
+
+	if n.Body == "fail" {
+		return errors.New("found failed")
+	}
+
+	// Back-fill the default priority of legacy notes.
+	if n.Priority == "" {
+		n.Priority = "normal"
+	}
+	return nil
+}
+
+func noteDocs(bodies ...string) []bson.D {
+	docs := make([]bson.D, len(bodies))
+	for i, body := range bodies {
+		docs[i] = bson.D{{Key: "body", Value: body}}
+	}
+	return docs
+}
+
+func TestFindHooksOnFirst(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch, noteDocs("hi")...))
+
+		note := &Note{}
+		util.AssertErrIsNil(t, coll.FirstWithCtx(context.Background(), bson.M{}, note))
+
+		require.Equal(t, 1, note.finding)
+		require.Equal(t, 1, note.found)
+		require.Equal(t, "normal", note.Priority)
+	})
+}
+
+func TestFoundHooksOnSimpleFind(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch, noteDocs("a", "b")...),
+			mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch, noteDocs("c")...),
+		)
+
+		var notes []Note
+		util.AssertErrIsNil(t, coll.SimpleFindWithCtx(context.Background(), &notes, bson.M{}))
+		require.Len(t, notes, 2)
+		for _, n := range notes {
+			require.Equal(t, 1, n.found)
+			require.Equal(t, "normal", n.Priority)
+		}
+
+		var ptrs []*Note
+		util.AssertErrIsNil(t, coll.SimpleFindWithCtx(context.Background(), &ptrs, bson.M{}))
+		require.Len(t, ptrs, 1)
+		require.Equal(t, 1, ptrs[0].found)
+	})
+}
+
+func TestFoundHooksOnSimpleAggregate(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch, noteDocs("a")...),
+			mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch, noteDocs("fail")...),
+		)
+
+		note := &Note{}
+		found, err := coll.SimpleAggregateFirstWithCtx(context.Background(), note)
+		util.AssertErrIsNil(t, err)
+		require.True(t, found)
+		require.Equal(t, 1, note.found)
+
+		var notes []*Note
+		err = coll.SimpleAggregateWithCtx(context.Background(), &notes)
+		require.EqualError(t, err, "found failed")
+	})
+}
+
+func TestFindingHooksOnSimpleFind(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch, noteDocs("a", "b")...),
+			mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch, noteDocs("c")...),
+		)
+
+		notes := []Note{{Body: "stale"}}
+		util.AssertErrIsNil(t, coll.SimpleFindWithCtx(context.Background(), &notes, bson.M{}))
+		require.Len(t, notes, 2)
+		for _, n := range notes {
+			require.Equal(t, 1, n.finding)
+			require.Equal(t, 1, n.found)
+		}
+		require.Equal(t, "a", notes[0].Body)
+
+		var ptrs []*Note
+		util.AssertErrIsNil(t, coll.SimpleFindWithCtx(context.Background(), &ptrs, bson.M{}))
+		require.Len(t, ptrs, 1)
+		require.Equal(t, 1, ptrs[0].finding)
+		require.Equal(t, "c", ptrs[0].Body)
+	})
+}
+
+func TestFindingHooksOnSimpleAggregate(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch, noteDocs("a")...),
+			mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch, noteDocs("b", "c")...),
+		)
+
+		note := &Note{}
+		found, err := coll.SimpleAggregateFirstWithCtx(context.Background(), note)
+		util.AssertErrIsNil(t, err)
+		require.True(t, found)
+		require.Equal(t, 1, note.finding)
+
+		var notes []*Note
+		util.AssertErrIsNil(t, coll.SimpleAggregateWithCtx(context.Background(), &notes))
+		require.Len(t, notes, 2)
+		for _, n := range notes {
+			require.Equal(t, 1, n.finding)
+			require.Equal(t, 1, n.found)
+		}
+	})
+}
+
+type Memo struct {
+	mgm.DefaultModel `bson:",inline"`
+
+	Body string `bson:"body"`
+}
+
+func (m *Memo) Finding(ctx context.Context) error {
+	return errors.New("finding failed")
+}
+
+func TestFindingHooksFailSimpleFind(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch, noteDocs("a")...),
+		)
+
+		var memos []Memo
+		require.EqualError(t, coll.SimpleFindWithCtx(context.Background(), &memos, bson.M{}), "finding failed")
+		require.Empty(t, memos)
+
+		_, err := coll.SimpleAggregateFirstWithCtx(context.Background(), &Memo{})
+		require.EqualError(t, err, "finding failed")
+	})
+}
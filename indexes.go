@@ -0,0 +1,497 @@
+package mgm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/uncle-gua/mgm/operator"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexAction is the kind of change SyncIndexes makes to an index.
+type IndexAction string
+
+const (
+	// IndexCreate action creates a declared index that does not exist.
+	IndexCreate IndexAction = "create"
+	// IndexDrop action drops an existing index that is not declared anymore.
+	IndexDrop IndexAction = "drop"
+	// IndexRecreate action drops an existing index whose keys or options differ
+	// from its declaration, then creates it again.
+	IndexRecreate IndexAction = "recreate"
+	// IndexModify action changes the TTL of an existing index using collMod.
+	IndexModify IndexAction = "modify"
+)
+
+// IndexChange is a change that EnsureIndexes or SyncIndexes makes to a collection's indexes.
+type IndexChange struct {
+	Collection string
+	Action     IndexAction
+	Name       string
+}
+
+func (c IndexChange) String() string {
+	return fmt.Sprintf("%s index %s.%s", c.Action, c.Collection, c.Name)
+}
+
+// ModelIndexes returns the indexes a model declares, using the `mgm` tags
+// of its fields and the IndexesGetter interface. Each index has a name:
+// a compound index is named by its group, other indexes are named the way
+// mongo names them by default (e.g "name_1").
+//
+// The field tag options are:
+//   - index: an ascending index. Use `index=desc`, `index=text`, `index=2dsphere`
+//     or `index=hashed` for other kinds of indexes.
+//   - unique, sparse: the unique and sparse index options (unique implies index).
+//   - ttl=<seconds>: a TTL index that expires documents after the given seconds.
+//   - partial: index only the documents that have the field.
+//   - group=<name>: adds the field to the compound index with the given name.
+//     The fields of a compound index are ordered by their position in the struct.
+func ModelIndexes(m Model) ([]mongo.IndexModel, error) {
+	var indexes []mongo.IndexModel
+	groups := map[string]*mongo.IndexModel{}
+	var groupNames []string
+
+	for _, f := range modelFields(reflect.TypeOf(m)) {
+		tag := f.mgm
+		if !tag.has("index") && !tag.has("unique") && !tag.has("ttl") && !tag.has("group") {
+			continue
+		}
+
+		key, err := indexKey(tag["index"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid index of field %s: %w", f.path, err)
+		}
+
+		opts, err := indexOptions(f.path, tag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid index of field %s: %w", f.path, err)
+		}
+
+		group, ok := tag["group"]
+		if !ok {
+			keys := bson.D{{Key: f.path, Value: key}}
+			indexes = append(indexes, mongo.IndexModel{Keys: keys, Options: opts.SetName(indexName(keys))})
+			continue
+		}
+
+		idx, ok := groups[group]
+		if !ok {
+			idx = &mongo.IndexModel{Keys: bson.D{}, Options: options.Index().SetName(group)}
+			groups[group] = idx
+			groupNames = append(groupNames, group)
+		}
+		idx.Keys = append(idx.Keys.(bson.D), bson.E{Key: f.path, Value: key})
+		mergeIndexOptions(idx.Options, opts)
+	}
+
+	for _, name := range groupNames {
+		indexes = append(indexes, *groups[name])
+	}
+
+	if getter, ok := m.(IndexesGetter); ok {
+		for _, idx := range getter.Indexes() {
+			if idx.Options == nil {
+				idx.Options = options.Index()
+			}
+			if idx.Options.Name == nil {
+				keys, ok := idx.Keys.(bson.D)
+				if !ok {
+					return nil, fmt.Errorf("index %v must have a name or bson.D keys", idx.Keys)
+				}
+				idx.Options.SetName(indexName(keys))
+			}
+			indexes = append(indexes, idx)
+		}
+	}
+
+	return indexes, nil
+}
+
+// EnsureIndexes creates the indexes the models declare, if they don't exist.
+// Existing indexes are not changed, even if their keys or options differ.
+func EnsureIndexes(models ...Model) ([]IndexChange, error) {
+	ctx, cancel := ctx()
+	defer cancel()
+
+	return EnsureIndexesWithCtx(ctx, models...)
+}
+
+// EnsureIndexesWithCtx creates the indexes the models declare using the specified
+// context, if they don't exist. Existing indexes are not changed.
+func EnsureIndexesWithCtx(ctx context.Context, models ...Model) ([]IndexChange, error) {
+	return syncIndexes(ctx, models, false, false)
+}
+
+// SyncIndexes creates the indexes the models declare and drops the indexes of
+// their collections that are not declared anymore. Existing indexes whose keys
+// or options (unique, sparse, ttl and partial) differ from their declarations
+// are dropped and created again, except for TTL changes that are made by collMod.
+// In dry-run mode, it just returns the changes it would make.
+func SyncIndexes(ctx context.Context, dryRun bool, models ...Model) ([]IndexChange, error) {
+	return syncIndexes(ctx, models, true, dryRun)
+}
+
+func syncIndexes(ctx context.Context, models []Model, drop bool, dryRun bool) ([]IndexChange, error) {
+	type collIndexes struct {
+		c       *mongo.Collection
+		indexes []mongo.IndexModel
+	}
+
+	// Group the declared indexes by collection, models may share a collection.
+	var namespaces []string
+	groups := map[string]*collIndexes{}
+
+	add := func(c *mongo.Collection, indexes []mongo.IndexModel) {
+		ns := c.Database().Name() + "." + c.Name()
+
+		g, ok := groups[ns]
+		if !ok {
+			g = &collIndexes{c: c}
+			groups[ns] = g
+			namespaces = append(namespaces, ns)
+		}
+		g.indexes = append(g.indexes, indexes...)
+	}
+
+	for _, m := range models {
+		indexes, err := ModelIndexes(m)
+		if err != nil {
+			return nil, err
+		}
+
+		coll := Coll(m)
+		add(coll.collection(ctx), indexes)
+
+		if r, ok := m.(Revisioned); ok {
+			add(coll.revisionCollection(ctx).collection(ctx), revisionIndexes(r))
+		}
+	}
+
+	var changes []IndexChange
+	for _, ns := range namespaces {
+		cs, err := syncCollIndexes(ctx, groups[ns].c, groups[ns].indexes, drop, dryRun)
+		changes = append(changes, cs...)
+		if err != nil {
+			return changes, err
+		}
+	}
+
+	return changes, nil
+}
+
+func syncCollIndexes(ctx context.Context, c *mongo.Collection, indexes []mongo.IndexModel, drop bool, dryRun bool) ([]IndexChange, error) {
+	cur, err := c.Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var existing []bson.Raw
+	if err := cur.All(ctx, &existing); err != nil {
+		return nil, err
+	}
+
+	specs := map[string]bson.Raw{}
+	for _, spec := range existing {
+		specs[spec.Lookup("name").StringValue()] = spec
+	}
+
+	var changes []IndexChange
+	var create []mongo.IndexModel
+	var dropNames []string
+	modify := map[string]int32{}
+	wanted := map[string]bool{"_id_": true}
+
+	for _, idx := range indexes {
+		name := *idx.Options.Name
+		if wanted[name] {
+			continue
+		}
+		wanted[name] = true
+
+		spec, ok := specs[name]
+		if !ok {
+			create = append(create, idx)
+			changes = append(changes, IndexChange{Collection: c.Name(), Action: IndexCreate, Name: name})
+			continue
+		}
+		if !drop {
+			continue
+		}
+
+		same, ttlOnly, err := sameIndex(idx, spec)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case same:
+		case ttlOnly:
+			modify[name] = *idx.Options.ExpireAfterSeconds
+			changes = append(changes, IndexChange{Collection: c.Name(), Action: IndexModify, Name: name})
+		default:
+			dropNames = append(dropNames, name)
+			create = append(create, idx)
+			changes = append(changes, IndexChange{Collection: c.Name(), Action: IndexRecreate, Name: name})
+		}
+	}
+
+	if drop {
+		var unwanted []string
+		for name := range specs {
+			if !wanted[name] {
+				unwanted = append(unwanted, name)
+			}
+		}
+		sort.Strings(unwanted)
+
+		for _, name := range unwanted {
+			changes = append(changes, IndexChange{Collection: c.Name(), Action: IndexDrop, Name: name})
+		}
+		dropNames = append(dropNames, unwanted...)
+	}
+
+	if dryRun {
+		return changes, nil
+	}
+
+	for _, name := range dropNames {
+		if _, err := c.Indexes().DropOne(ctx, name); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, change := range changes {
+		if change.Action != IndexModify {
+			continue
+		}
+
+		cmd := bson.D{
+			{Key: "collMod", Value: c.Name()},
+			{Key: "index", Value: bson.D{{Key: "name", Value: change.Name}, {Key: "expireAfterSeconds", Value: modify[change.Name]}}},
+		}
+		if err := c.Database().RunCommand(ctx, cmd).Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(create) != 0 {
+		if _, err := c.Indexes().CreateMany(ctx, create); err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+// sameIndex compares a declared index with the spec of an existing index, which
+// is listed by listIndexes. It returns whether they are the same, or whether just
+// their TTLs differ. The keys of text indexes are not compared, because they are
+// stored as the `_fts` and `_ftsx` keys.
+func sameIndex(idx mongo.IndexModel, spec bson.Raw) (same bool, ttlOnly bool, err error) {
+	keys, err := bson.Marshal(idx.Keys)
+	if err != nil {
+		return false, false, err
+	}
+
+	opts := idx.Options
+	existingKeys, _ := spec.Lookup("key").DocumentOK()
+
+	same = isTextIndex(bson.Raw(keys)) || sameKeys(bson.Raw(keys), existingKeys)
+	same = same && (opts.Unique != nil && *opts.Unique) == indexFlag(spec.Lookup("unique"))
+	same = same && (opts.Sparse != nil && *opts.Sparse) == indexFlag(spec.Lookup("sparse"))
+
+	existingPartial := spec.Lookup("partialFilterExpression")
+	if opts.PartialFilterExpression != nil {
+		partial, err := bson.Marshal(bson.M{"p": opts.PartialFilterExpression})
+		if err != nil {
+			return false, false, err
+		}
+		same = same && sameValue(bson.Raw(partial).Lookup("p"), existingPartial)
+	} else {
+		same = same && existingPartial.Type == 0
+	}
+
+	ttl, ok := spec.Lookup("expireAfterSeconds").AsInt64OK()
+	if !same || (opts.ExpireAfterSeconds == nil) != !ok {
+		return false, false, nil
+	}
+	if opts.ExpireAfterSeconds == nil || int64(*opts.ExpireAfterSeconds) == ttl {
+		return true, false, nil
+	}
+
+	return false, true, nil
+}
+
+// indexFlag returns the value of a boolean option of an index spec, false if
+// the option is not set.
+func indexFlag(v bson.RawValue) bool {
+	if b, ok := v.BooleanOK(); ok {
+		return b
+	}
+
+	n, _ := numberValue(v)
+	return n != 0
+}
+
+// isTextIndex returns true if the index keys have a text key.
+func isTextIndex(keys bson.Raw) bool {
+	elems, _ := keys.Elements()
+	for _, e := range elems {
+		if s, ok := e.Value().StringValueOK(); ok && s == "text" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sameKeys returns true if the index keys have the same fields, in the same order,
+// with the same values (e.g 1 and 1.0 are the same value).
+func sameKeys(a, b bson.Raw) bool {
+	ae, _ := a.Elements()
+	be, _ := b.Elements()
+	if len(ae) != len(be) {
+		return false
+	}
+
+	for i := range ae {
+		if ae[i].Key() != be[i].Key() || !sameValue(ae[i].Value(), be[i].Value()) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sameValue compares bson values, numbers by their value and documents
+// regardless of the order of their fields.
+func sameValue(a, b bson.RawValue) bool {
+	if x, ok := numberValue(a); ok {
+		y, ok := numberValue(b)
+		return ok && x == y
+	}
+
+	if a.Type == bson.TypeEmbeddedDocument && b.Type == bson.TypeEmbeddedDocument {
+		ae, _ := a.Document().Elements()
+		be, _ := b.Document().Elements()
+		if len(ae) != len(be) {
+			return false
+		}
+
+		for _, e := range ae {
+			v, err := b.Document().LookupErr(e.Key())
+			if err != nil || !sameValue(e.Value(), v) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	if a.Type == bson.TypeArray && b.Type == bson.TypeArray {
+		av, _ := a.Array().Values()
+		bv, _ := b.Array().Values()
+		if len(av) != len(bv) {
+			return false
+		}
+
+		for i := range av {
+			if !sameValue(av[i], bv[i]) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return a.Equal(b)
+}
+
+// numberValue returns the value of a bson number.
+func numberValue(v bson.RawValue) (float64, bool) {
+	switch v.Type {
+	case bson.TypeInt32:
+		return float64(v.Int32()), true
+	case bson.TypeInt64:
+		return float64(v.Int64()), true
+	case bson.TypeDouble:
+		return v.Double(), true
+	}
+
+	return 0, false
+}
+
+// indexKey returns an index key value of the `index` tag option value.
+func indexKey(kind string) (interface{}, error) {
+	switch kind {
+	case "", "asc":
+		return 1, nil
+	case "desc":
+		return -1, nil
+	case "text", "2dsphere", "hashed":
+		return kind, nil
+	}
+
+	return nil, fmt.Errorf("unknown index kind %q", kind)
+}
+
+func indexOptions(path string, tag tagOptions) (*options.IndexOptions, error) {
+	opts := options.Index()
+
+	if tag.has("unique") {
+		opts.SetUnique(true)
+	}
+	if tag.has("sparse") {
+		opts.SetSparse(true)
+	}
+	if tag.has("partial") {
+		opts.SetPartialFilterExpression(bson.M{path: bson.M{operator.Exists: true}})
+	}
+	if ttl, ok := tag["ttl"]; ok {
+		seconds, err := strconv.Atoi(ttl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ttl %q", ttl)
+		}
+		opts.SetExpireAfterSeconds(int32(seconds))
+	}
+
+	return opts, nil
+}
+
+func mergeIndexOptions(dst, src *options.IndexOptions) {
+	if src.Unique != nil {
+		dst.Unique = src.Unique
+	}
+	if src.Sparse != nil {
+		dst.Sparse = src.Sparse
+	}
+	if src.ExpireAfterSeconds != nil {
+		dst.ExpireAfterSeconds = src.ExpireAfterSeconds
+	}
+	if src.PartialFilterExpression != nil {
+		if dst.PartialFilterExpression == nil {
+			dst.PartialFilterExpression = bson.M{}
+		}
+		for k, v := range src.PartialFilterExpression.(bson.M) {
+			dst.PartialFilterExpression.(bson.M)[k] = v
+		}
+	}
+}
+
+// indexName returns the default name mongo gives to an index with the keys.
+func indexName(keys bson.D) string {
+	parts := make([]string, 0, len(keys)*2)
+
+	for _, k := range keys {
+		parts = append(parts, k.Key, fmt.Sprint(k.Value))
+	}
+
+	return strings.Join(parts, "_")
+}
@@ -0,0 +1,277 @@
+package mgm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uncle-gua/mgm"
+	"github.com/uncle-gua/mgm/internal/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+type Location struct {
+	Type        string    `bson:"type"`
+	Coordinates []float64 `bson:"coordinates" mgm:"index=2dsphere"`
+}
+
+type Account struct {
+	mgm.DefaultModel `bson:",inline"`
+
+	Email     string   `bson:"email" mgm:"unique"`
+	Bio       string   `bson:"bio" mgm:"index=text"`
+	Tenant    string   `bson:"tenant" mgm:"group=tenant_name,unique"`
+	Name      string   `bson:"name" mgm:"group=tenant_name,index=desc"`
+	Token     string   `bson:"token,omitempty" mgm:"index,sparse,partial"`
+	Location  Location `bson:"location"`
+	ExpiresAt int64    `bson:"expires_at" mgm:"ttl=3600"`
+
+	coll *mgm.Collection
+}
+
+func (a *Account) Indexes() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{Keys: bson.D{{Key: "created_at", Value: -1}}},
+	}
+}
+
+func (a *Account) Collection() *mgm.Collection {
+	return a.coll
+}
+
+func TestModelIndexes(t *testing.T) {
+	indexes, err := mgm.ModelIndexes(&Account{})
+	util.AssertErrIsNil(t, err)
+
+	names := []string{}
+	for _, idx := range indexes {
+		names = append(names, *idx.Options.Name)
+	}
+	require.Equal(t, []string{
+		"email_1", "bio_text", "token_1", "location.coordinates_2dsphere", "expires_at_1", "tenant_name", "created_at_-1",
+	}, names)
+
+	require.True(t, *indexes[0].Options.Unique)
+	require.True(t, *indexes[2].Options.Sparse)
+	require.Equal(t, bson.M{"token": bson.M{"$exists": true}}, indexes[2].Options.PartialFilterExpression)
+	require.Equal(t, int32(3600), *indexes[4].Options.ExpireAfterSeconds)
+
+	require.Equal(t, bson.D{{Key: "tenant", Value: 1}, {Key: "name", Value: -1}}, indexes[5].Keys)
+	require.True(t, *indexes[5].Options.Unique)
+}
+
+func TestModelIndexesWithInvalidTag(t *testing.T) {
+	type Invalid struct {
+		mgm.DefaultModel `bson:",inline"`
+		Name             string `bson:"name" mgm:"index=unknown"`
+	}
+
+	_, err := mgm.ModelIndexes(&Invalid{})
+	require.Error(t, err)
+}
+
+// indexesResponse returns the listIndexes response of the indexes with the names.
+// The indexes that Account declares have the declared keys and options.
+func indexesResponse(names ...string) bson.D {
+	declared, _ := mgm.ModelIndexes(&Account{})
+
+	docs := []bson.D{}
+	for _, name := range names {
+		doc := bson.D{{Key: "name", Value: name}, {Key: "key", Value: bson.D{{Key: name, Value: 1}}}}
+
+		for _, idx := range declared {
+			if *idx.Options.Name == name {
+				doc = indexSpec(idx)
+			}
+		}
+
+		docs = append(docs, doc)
+	}
+
+	return indexSpecsResponse(docs...)
+}
+
+// indexSpecsResponse returns the listIndexes response of the index specs.
+func indexSpecsResponse(specs ...bson.D) bson.D {
+	return mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch, specs...)
+}
+
+// indexSpec returns the spec of the index, the way listIndexes lists it.
+func indexSpec(idx mongo.IndexModel) bson.D {
+	spec := bson.D{{Key: "v", Value: 2}, {Key: "key", Value: idx.Keys}, {Key: "name", Value: *idx.Options.Name}}
+
+	if idx.Options.Unique != nil {
+		spec = append(spec, bson.E{Key: "unique", Value: *idx.Options.Unique})
+	}
+	if idx.Options.Sparse != nil {
+		spec = append(spec, bson.E{Key: "sparse", Value: *idx.Options.Sparse})
+	}
+	if idx.Options.ExpireAfterSeconds != nil {
+		spec = append(spec, bson.E{Key: "expireAfterSeconds", Value: *idx.Options.ExpireAfterSeconds})
+	}
+	if idx.Options.PartialFilterExpression != nil {
+		spec = append(spec, bson.E{Key: "partialFilterExpression", Value: idx.Options.PartialFilterExpression})
+	}
+
+	return spec
+}
+
+func TestSyncIndexesDryRun(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(indexesResponse("_id_", "email_1", "bio_text", "old_1", "token_1", "location.coordinates_2dsphere"))
+
+		changes, err := mgm.SyncIndexes(context.Background(), true, &Account{coll: coll})
+		util.AssertErrIsNil(t, err)
+
+		name := coll.Name()
+		require.Equal(t, []mgm.IndexChange{
+			{Collection: name, Action: mgm.IndexCreate, Name: "expires_at_1"},
+			{Collection: name, Action: mgm.IndexCreate, Name: "tenant_name"},
+			{Collection: name, Action: mgm.IndexCreate, Name: "created_at_-1"},
+			{Collection: name, Action: mgm.IndexDrop, Name: "old_1"},
+		}, changes)
+
+		require.Equal(t, "listIndexes", mt.GetStartedEvent().CommandName)
+		require.Nil(t, mt.GetStartedEvent())
+	})
+}
+
+func TestSyncIndexes(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(
+			indexesResponse("_id_", "email_1", "bio_text", "old_1", "token_1", "location.coordinates_2dsphere", "expires_at_1", "tenant_name"),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)
+
+		changes, err := mgm.SyncIndexes(context.Background(), false, &Account{coll: coll})
+		util.AssertErrIsNil(t, err)
+		require.Len(t, changes, 2)
+
+		require.Equal(t, "listIndexes", mt.GetStartedEvent().CommandName)
+
+		evt := mt.GetStartedEvent()
+		require.Equal(t, "dropIndexes", evt.CommandName)
+		require.Equal(t, "old_1", evt.Command.Lookup("index").StringValue())
+
+		evt = mt.GetStartedEvent()
+		require.Equal(t, "createIndexes", evt.CommandName)
+		require.Equal(t, "created_at_-1", evt.Command.Lookup("indexes").Array().Index(0).Value().Document().Lookup("name").StringValue())
+	})
+}
+
+func TestEnsureIndexesDoesNotDrop(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(
+			indexesResponse("_id_", "old_1"),
+			mtest.CreateSuccessResponse(),
+		)
+
+		changes, err := mgm.EnsureIndexesWithCtx(context.Background(), &Account{coll: coll})
+		util.AssertErrIsNil(t, err)
+		require.Len(t, changes, 7)
+
+		for _, c := range changes {
+			require.Equal(t, mgm.IndexCreate, c.Action)
+		}
+
+		mt.GetStartedEvent()
+		require.Equal(t, "createIndexes", mt.GetStartedEvent().CommandName)
+		require.Nil(t, mt.GetStartedEvent())
+	})
+}
+
+func TestSyncIndexesChangedOptionsDryRun(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		declared, err := mgm.ModelIndexes(&Account{})
+		util.AssertErrIsNil(t, err)
+
+		specs := []bson.D{{{Key: "name", Value: "_id_"}, {Key: "key", Value: bson.D{{Key: "_id", Value: 1}}}}}
+		for _, idx := range declared {
+			spec := indexSpec(idx)
+
+			switch *idx.Options.Name {
+			case "email_1":
+				// The unique option is removed.
+				spec = bson.D{{Key: "v", Value: 2}, {Key: "key", Value: bson.D{{Key: "email", Value: 1}}}, {Key: "name", Value: "email_1"}}
+			case "tenant_name":
+				// The keys are declared in another order.
+				spec[1].Value = bson.D{{Key: "name", Value: -1}, {Key: "tenant", Value: 1}}
+			case "expires_at_1":
+				spec[len(spec)-1].Value = int32(60)
+			case "token_1":
+				// The key value is stored as a double.
+				spec[1].Value = bson.D{{Key: "token", Value: 1.0}}
+			case "bio_text":
+				spec[1].Value = bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: 1}}
+			}
+
+			specs = append(specs, spec)
+		}
+
+		mt.AddMockResponses(indexSpecsResponse(specs...))
+
+		changes, err := mgm.SyncIndexes(context.Background(), true, &Account{coll: coll})
+		util.AssertErrIsNil(t, err)
+
+		name := coll.Name()
+		require.Equal(t, []mgm.IndexChange{
+			{Collection: name, Action: mgm.IndexRecreate, Name: "email_1"},
+			{Collection: name, Action: mgm.IndexModify, Name: "expires_at_1"},
+			{Collection: name, Action: mgm.IndexRecreate, Name: "tenant_name"},
+		}, changes)
+
+		require.Equal(t, "listIndexes", mt.GetStartedEvent().CommandName)
+		require.Nil(t, mt.GetStartedEvent())
+	})
+}
+
+func TestSyncIndexesChangedOptions(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		declared, err := mgm.ModelIndexes(&Account{})
+		util.AssertErrIsNil(t, err)
+
+		var specs []bson.D
+		for _, idx := range declared {
+			spec := indexSpec(idx)
+
+			switch *idx.Options.Name {
+			case "email_1":
+				spec = append(spec[:3], bson.E{Key: "unique", Value: false})
+			case "expires_at_1":
+				spec[len(spec)-1].Value = int32(60)
+			}
+
+			specs = append(specs, spec)
+		}
+
+		mt.AddMockResponses(
+			indexSpecsResponse(specs...),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)
+
+		_, err = mgm.SyncIndexes(context.Background(), false, &Account{coll: coll})
+		util.AssertErrIsNil(t, err)
+
+		require.Equal(t, "listIndexes", mt.GetStartedEvent().CommandName)
+
+		evt := mt.GetStartedEvent()
+		require.Equal(t, "dropIndexes", evt.CommandName)
+		require.Equal(t, "email_1", evt.Command.Lookup("index").StringValue())
+
+		evt = mt.GetStartedEvent()
+		require.Equal(t, "collMod", evt.CommandName)
+		require.Equal(t, "expires_at_1", evt.Command.Lookup("index", "name").StringValue())
+		require.Equal(t, int64(3600), evt.Command.Lookup("index", "expireAfterSeconds").AsInt64())
+
+		evt = mt.GetStartedEvent()
+		require.Equal(t, "createIndexes", evt.CommandName)
+		index := evt.Command.Lookup("indexes").Array().Index(0).Value().Document()
+		require.Equal(t, "email_1", index.Lookup("name").StringValue())
+		require.True(t, index.Lookup("unique").Boolean())
+	})
+}
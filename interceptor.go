@@ -0,0 +1,150 @@
+package mgm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrOpCanceled is returned when an interceptor returns without calling the next
+// handler and without an error.
+var ErrOpCanceled = errors.New("operation canceled by an interceptor")
+
+// ErrInvalidOpInfo is returned when an interceptor changes the type of
+// an operation's options or documents.
+var ErrInvalidOpInfo = errors.New("invalid operation info")
+
+// OpKind is the kind of a collection operation.
+type OpKind string
+
+// The kinds of collection operations.
+const (
+	OpFind       OpKind = "find"
+	OpFirst      OpKind = "first"
+	OpCount      OpKind = "count"
+	OpAggregate  OpKind = "aggregate"
+	OpInsert     OpKind = "insert"
+	OpInsertMany OpKind = "insertMany"
+	OpUpdate     OpKind = "update"
+	OpUpdateMany OpKind = "updateMany"
+	OpDelete     OpKind = "delete"
+	OpDeleteMany OpKind = "deleteMany"
+	OpBulkWrite  OpKind = "bulkWrite"
+	OpReplace    OpKind = "replace"
+	OpWatch      OpKind = "watch"
+
+	OpFindOneAndUpdate  OpKind = "findOneAndUpdate"
+	OpFindOneAndReplace OpKind = "findOneAndReplace"
+	OpFindOneAndDelete  OpKind = "findOneAndDelete"
+)
+
+// OpInfo describes a collection operation. Interceptors can change the
+// filter, update and options before calling the next handler, but must
+// keep their types, otherwise the operation fails with ErrInvalidOpInfo.
+type OpInfo struct {
+	// Collection is the collection's name.
+	Collection string
+	Op         OpKind
+	// Filter is the operation's filter, or its pipeline for aggregations and change streams.
+	Filter interface{}
+	// Update is the update document of update operations, or the
+	// replacement document of replace operations.
+	Update interface{}
+	// Model is the operation's model, nil for operations on multiple documents.
+	Model Model
+	// Documents are the documents of insertMany operations, or
+	// the mongo.WriteModel values of bulkWrite operations.
+	Documents []interface{}
+	// Options are the operation's driver options, e.g []*options.FindOptions
+	// for find operations.
+	Options interface{}
+}
+
+// opOptions returns the operation's options, or ErrInvalidOpInfo if they're
+// not of the operation's options type.
+func opOptions[T any](op *OpInfo) ([]T, error) {
+	opts, ok := op.Options.([]T)
+	if !ok {
+		return nil, fmt.Errorf("%w: the options of %s operations must be %T, got %T", ErrInvalidOpInfo, op.Op, opts, op.Options)
+	}
+
+	return opts, nil
+}
+
+// Handler runs a collection operation.
+type Handler func(ctx context.Context, op *OpInfo) error
+
+// Interceptor wraps the handler of collection operations, e.g to log, measure,
+// guard or rewrite them. Return an error without calling the next handler
+// to cancel an operation.
+type Interceptor func(next Handler) Handler
+
+var interceptors []Interceptor
+var collInterceptors = map[string][]Interceptor{}
+var interceptorsMu sync.RWMutex
+
+// Intercept registers interceptors that wrap the operations of all collections.
+// Interceptors run in the order they are registered.
+func Intercept(fns ...Interceptor) {
+	interceptorsMu.Lock()
+	defer interceptorsMu.Unlock()
+
+	interceptors = append(interceptors, fns...)
+}
+
+// InterceptCollection registers interceptors that wrap the operations of the
+// collection with the specified name. They run after the global interceptors.
+func InterceptCollection(name string, fns ...Interceptor) {
+	interceptorsMu.Lock()
+	defer interceptorsMu.Unlock()
+
+	collInterceptors[name] = append(collInterceptors[name], fns...)
+}
+
+// ResetInterceptors removes all registered interceptors.
+func ResetInterceptors() {
+	interceptorsMu.Lock()
+	defer interceptorsMu.Unlock()
+
+	interceptors = nil
+	collInterceptors = map[string][]Interceptor{}
+}
+
+// intercept runs the operation's handler wrapped by the collection's interceptors.
+func (coll *Collection) intercept(ctx context.Context, op *OpInfo, h Handler) error {
+	op.Collection = coll.Name()
+
+	ctx = coll.sessionCtx(ctx)
+	if err := coll.checkSession(ctx); err != nil {
+		return err
+	}
+
+	interceptorsMu.RLock()
+	chain := append(append([]Interceptor{}, interceptors...), collInterceptors[op.Collection]...)
+	interceptorsMu.RUnlock()
+
+	if len(chain) == 0 {
+		return h(ctx, op)
+	}
+
+	called := false
+	next := h
+	h = func(ctx context.Context, op *OpInfo) error {
+		called = true
+		return next(ctx, op)
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		h = chain[i](h)
+	}
+
+	if err := h(ctx, op); err != nil || !called {
+		if err == nil {
+			err = ErrOpCanceled
+		}
+		return err
+	}
+
+	return nil
+}
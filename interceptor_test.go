@@ -0,0 +1,141 @@
+package mgm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uncle-gua/mgm"
+	"github.com/uncle-gua/mgm/internal/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestInterceptorsWrapOperations(t *testing.T) {
+	defer mgm.ResetInterceptors()
+
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		var ops []string
+		mgm.Intercept(func(next mgm.Handler) mgm.Handler {
+			return func(ctx context.Context, op *mgm.OpInfo) error {
+				ops = append(ops, op.Collection+":"+string(op.Op))
+				return next(ctx, op)
+			}
+		})
+
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch, bson.D{{Key: "name", Value: "Ali"}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		)
+
+		ctx := context.Background()
+		doc := NewDoc("Ali", 24)
+		util.AssertErrIsNil(t, coll.CreateWithCtx(ctx, doc))
+		util.AssertErrIsNil(t, coll.FirstWithCtx(ctx, bson.M{}, doc))
+		util.AssertErrIsNil(t, coll.DeleteWithCtx(ctx, doc))
+
+		name := coll.Name()
+		require.Equal(t, []string{name + ":insert", name + ":first", name + ":delete"}, ops)
+	})
+}
+
+func TestInterceptorRewritesFilter(t *testing.T) {
+	defer mgm.ResetInterceptors()
+
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mgm.InterceptCollection(coll.Name(), func(next mgm.Handler) mgm.Handler {
+			return func(ctx context.Context, op *mgm.OpInfo) error {
+				if op.Op == mgm.OpFind {
+					op.Filter = bson.M{"$and": bson.A{op.Filter, bson.M{"org": "acme"}}}
+				}
+				return next(ctx, op)
+			}
+		})
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch))
+
+		var docs []Doc
+		util.AssertErrIsNil(t, coll.SimpleFindWithCtx(context.Background(), &docs, bson.M{"age": 24}))
+
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		conds := filter.Lookup("$and").Array()
+		require.Equal(t, "acme", conds.Index(1).Value().Document().Lookup("org").StringValue())
+	})
+}
+
+func TestInterceptorCancelsOperation(t *testing.T) {
+	defer mgm.ResetInterceptors()
+
+	errDenied := errors.New("denied")
+	mgm.Intercept(func(next mgm.Handler) mgm.Handler {
+		return func(ctx context.Context, op *mgm.OpInfo) error {
+			if op.Op == mgm.OpDeleteMany || op.Op == mgm.OpFirst {
+				return errDenied
+			}
+			if op.Op == mgm.OpCount {
+				return nil
+			}
+			return next(ctx, op)
+		}
+	})
+
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		_, err := coll.DeleteManyCtx(context.Background(), bson.M{})
+		require.Equal(t, errDenied, err)
+
+		_, err = coll.CountDocumentsWithCtx(context.Background(), bson.M{})
+		require.Equal(t, mgm.ErrOpCanceled, err)
+
+		var marshalErr mongo.MarshalError
+		require.True(t, errors.As(coll.FindOneWithCtx(context.Background(), bson.M{"age": 24}).Err(), &marshalErr))
+		require.Equal(t, errDenied, marshalErr.Err)
+
+		require.Nil(t, mt.GetStartedEvent())
+	})
+}
+
+func TestInterceptorChangesOptionsType(t *testing.T) {
+	defer mgm.ResetInterceptors()
+
+	mgm.Intercept(func(next mgm.Handler) mgm.Handler {
+		return func(ctx context.Context, op *mgm.OpInfo) error {
+			op.Options = options.Find()
+			return next(ctx, op)
+		}
+	})
+
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		_, err := coll.FindWithCtx(context.Background(), bson.M{})
+		require.True(t, errors.Is(err, mgm.ErrInvalidOpInfo))
+		require.EqualError(t, err, "invalid operation info: the options of find operations must be []*options.FindOptions, got *options.FindOptions")
+
+		err = coll.CreateWithCtx(context.Background(), NewDoc("Ali", 24))
+		require.True(t, errors.Is(err, mgm.ErrInvalidOpInfo))
+
+		require.Nil(t, mt.GetStartedEvent())
+	})
+}
+
+func TestCollectionInterceptorsAreScoped(t *testing.T) {
+	defer mgm.ResetInterceptors()
+
+	called := false
+	mgm.InterceptCollection("another_collection", func(next mgm.Handler) mgm.Handler {
+		return func(ctx context.Context, op *mgm.OpInfo) error {
+			called = true
+			return next(ctx, op)
+		}
+	})
+
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+
+		_, err := coll.DeleteManyCtx(context.Background(), bson.M{})
+		util.AssertErrIsNil(t, err)
+		require.False(t, called)
+	})
+}
@@ -0,0 +1,70 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Usage is the usage of the migrate commands.
+const Usage = `commands:
+  up            apply the pending migrations
+  down [steps]  revert the last applied migrations (default 1)
+  status        print the status of the migrations`
+
+// Run runs a migrate command (up, down or status) using the migrator
+// and writes its output to out.
+func Run(ctx context.Context, m *Migrator, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("missing command\n" + Usage)
+	}
+
+	switch args[0] {
+	case "up":
+		ids, err := m.Migrate(ctx)
+		printIDs(out, "applied", ids)
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid steps %q", args[1])
+			}
+		}
+
+		ids, err := m.Rollback(ctx, steps)
+		printIDs(out, "reverted", ids)
+		return err
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tAPPLIED AT\tDESCRIPTION")
+		for _, s := range statuses {
+			at := "pending"
+			if s.Applied() {
+				at = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", s.ID, at, s.Description)
+		}
+		return w.Flush()
+	}
+
+	return fmt.Errorf("unknown command %q\n%s", args[0], Usage)
+}
+
+func printIDs(out io.Writer, action string, ids []string) {
+	if len(ids) == 0 {
+		fmt.Fprintf(out, "no migrations %s\n", action)
+	}
+	for _, id := range ids {
+		fmt.Fprintf(out, "%s %s\n", action, id)
+	}
+}
@@ -0,0 +1,375 @@
+// Package migrate runs versioned data migrations and records the applied
+// migrations in a collection of the database.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/uncle-gua/mgm"
+	"github.com/uncle-gua/mgm/field"
+	"github.com/uncle-gua/mgm/operator"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrLocked is returned when another instance is running migrations.
+var ErrLocked = errors.New("migrations are locked by another instance")
+
+// ErrLockLost is returned when the migrations lock expires or is taken by
+// another instance while running migrations.
+var ErrLockLost = errors.New("migrations lock is lost")
+
+// lockID is the id of the lock document.
+const lockID = "lock"
+
+// Migration is a versioned data migration. Migrations run in the order of their IDs,
+// so use sortable IDs (e.g "20200101120000_add_books_pages").
+type Migration struct {
+	ID          string
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+	Down        func(ctx context.Context, db *mongo.Database) error
+
+	// Transactional runs the migration and records it in a transaction.
+	Transactional bool
+}
+
+// MigrationStatus is the status of a registered migration.
+type MigrationStatus struct {
+	ID          string     `json:"id"`
+	Description string     `json:"description"`
+	AppliedAt   *time.Time `json:"applied_at,omitempty"`
+}
+
+// Applied returns true if the migration is applied.
+func (s MigrationStatus) Applied() bool {
+	return s.AppliedAt != nil
+}
+
+type record struct {
+	ID        string    `bson:"_id"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+// Migrator runs the migrations on a database.
+type Migrator struct {
+	db         *mongo.Database
+	migrations []Migration
+
+	// CollectionName is the name of the collection that records the applied migrations.
+	CollectionName string
+	// LockCollectionName is the name of the collection that keeps the lock document.
+	LockCollectionName string
+	// LockTTL is the duration after which a lock that was not released expires.
+	// The lock is renewed every third of it while running migrations.
+	LockTTL time.Duration
+}
+
+// New returns a new migrator of the database with the provided migrations.
+func New(db *mongo.Database, migrations ...Migration) *Migrator {
+	m := &Migrator{
+		db:                 db,
+		CollectionName:     "migrations",
+		LockCollectionName: "migrations_lock",
+		LockTTL:            10 * time.Minute,
+	}
+	m.Add(migrations...)
+
+	return m
+}
+
+// Add adds migrations to the migrator.
+func (m *Migrator) Add(migrations ...Migration) {
+	m.migrations = append(m.migrations, migrations...)
+
+	sort.SliceStable(m.migrations, func(i, j int) bool {
+		return m.migrations[i].ID < m.migrations[j].ID
+	})
+}
+
+// Migrate applies the pending migrations and returns their IDs.
+func (m *Migrator) Migrate(ctx context.Context) ([]string, error) {
+	var done []string
+
+	err := m.withLock(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.ID]; ok {
+				continue
+			}
+			if mig.Up == nil {
+				return fmt.Errorf("migration %s has no up step", mig.ID)
+			}
+
+			err := m.run(ctx, mig, mig.Up, func(ctx context.Context) error {
+				_, err := m.coll().InsertOne(ctx, record{ID: mig.ID, AppliedAt: time.Now().UTC()})
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %s: %w", mig.ID, err)
+			}
+
+			done = append(done, mig.ID)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Rollback reverts the last applied steps migrations and returns their IDs.
+func (m *Migrator) Rollback(ctx context.Context, steps int) ([]string, error) {
+	var done []string
+
+	err := m.withLock(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.ID]; !ok {
+				continue
+			}
+			if mig.Down == nil {
+				return fmt.Errorf("migration %s has no down step", mig.ID)
+			}
+
+			err := m.run(ctx, mig, mig.Down, func(ctx context.Context) error {
+				_, err := m.coll().DeleteOne(ctx, bson.M{field.ID: mig.ID})
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %s: %w", mig.ID, err)
+			}
+
+			done = append(done, mig.ID)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Status returns the status of the registered migrations.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]MigrationStatus, len(m.migrations))
+	for i, mig := range m.migrations {
+		res[i] = MigrationStatus{ID: mig.ID, Description: mig.Description}
+
+		if at, ok := applied[mig.ID]; ok {
+			at := at
+			res[i].AppliedAt = &at
+		}
+	}
+
+	return res, nil
+}
+
+// run runs the migration step and records the result, in a transaction if the
+// migration is transactional.
+func (m *Migrator) run(ctx context.Context, mig Migration, step func(context.Context, *mongo.Database) error, record func(context.Context) error) error {
+	if !mig.Transactional {
+		if err := step(ctx, m.db); err != nil {
+			return err
+		}
+		return record(ctx)
+	}
+
+	return mgm.TransactionWithClient(ctx, m.db.Client(), func(session mongo.Session, sc mongo.SessionContext) error {
+		if err := step(sc, m.db); err != nil {
+			return err
+		}
+
+		return record(sc)
+	})
+}
+
+// applied returns the applied migrations and their apply time.
+func (m *Migrator) applied(ctx context.Context) (map[string]time.Time, error) {
+	cur, err := m.coll().Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	var records []record
+	if err := cur.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	res := map[string]time.Time{}
+	for _, r := range records {
+		res[r.ID] = r.AppliedAt
+	}
+
+	return res, nil
+}
+
+// withLock runs the function while holding the migrations lock. The lock is renewed
+// while the function runs, and the function's context is canceled if the lock is lost.
+func (m *Migrator) withLock(ctx context.Context, f func(ctx context.Context) error) error {
+	owner := lockOwner()
+	now := time.Now().UTC()
+
+	// Take the lock if it does not exist or has expired. If another instance
+	// holds it, the upsert fails with a duplicate key error.
+	_, err := m.lockColl().UpdateOne(ctx,
+		bson.M{field.ID: lockID, "expires_at": bson.M{operator.Lt: now}},
+		bson.M{operator.Set: bson.M{"owner": owner, "locked_at": now, "expires_at": now.Add(m.LockTTL)}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrLocked
+	}
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_, _ = m.lockColl().DeleteOne(ctx, bson.M{field.ID: lockID, "owner": owner})
+	}()
+
+	lockCtx, cancel := context.WithCancel(ctx)
+	lost := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		if m.renewLock(lockCtx, owner) {
+			close(lost)
+			cancel()
+		}
+	}()
+
+	err = f(lockCtx)
+	cancel()
+	<-done
+
+	select {
+	case <-lost:
+		return ErrLockLost
+	default:
+		return err
+	}
+}
+
+// renewLock renews the lock of the owner until the context is done. It returns
+// true if the lock is lost, i.e it's not renewed because the owner doesn't hold it.
+func (m *Migrator) renewLock(ctx context.Context, owner string) bool {
+	interval := m.LockTTL / 3
+	if interval <= 0 {
+		return false
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+
+		res, err := m.lockColl().UpdateOne(ctx,
+			bson.M{field.ID: lockID, "owner": owner},
+			bson.M{operator.Set: bson.M{"expires_at": time.Now().UTC().Add(m.LockTTL)}},
+		)
+		if ctx.Err() != nil {
+			return false
+		}
+		if err != nil || res.MatchedCount == 0 {
+			return true
+		}
+	}
+}
+
+func (m *Migrator) coll() *mongo.Collection {
+	return m.db.Collection(m.CollectionName)
+}
+
+func (m *Migrator) lockColl() *mongo.Collection {
+	return m.db.Collection(m.LockCollectionName)
+}
+
+func lockOwner() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d:%s", host, os.Getpid(), primitive.NewObjectID().Hex())
+}
+
+//--------------------------------
+// Default registry
+//--------------------------------
+
+var registry []Migration
+
+// Register registers migrations to the default registry. Call it from the
+// init function of your migrations' package.
+func Register(migrations ...Migration) {
+	registry = append(registry, migrations...)
+}
+
+// Registered returns the migrations of the default registry.
+func Registered() []Migration {
+	return append([]Migration(nil), registry...)
+}
+
+// Default returns a migrator of the mgm default database with the registered migrations.
+func Default() (*Migrator, error) {
+	_, _, db, err := mgm.DefaultConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	return New(db, registry...), nil
+}
+
+// Migrate applies the registered pending migrations on the mgm default database.
+func Migrate(ctx context.Context) ([]string, error) {
+	m, err := Default()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Migrate(ctx)
+}
+
+// Rollback reverts the last applied steps migrations on the mgm default database.
+func Rollback(ctx context.Context, steps int) ([]string, error) {
+	m, err := Default()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Rollback(ctx, steps)
+}
+
+// Status returns the status of the registered migrations on the mgm default database.
+func Status(ctx context.Context) ([]MigrationStatus, error) {
+	m, err := Default()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Status(ctx)
+}
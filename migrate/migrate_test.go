@@ -0,0 +1,194 @@
+package migrate_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uncle-gua/mgm/internal/util"
+	"github.com/uncle-gua/mgm/migrate"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func runMock(t *testing.T, fn func(mt *mtest.T)) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("mock", fn)
+}
+
+// newMigrator returns a migrator with two migrations that record their calls.
+func newMigrator(mt *mtest.T, calls *[]string) *migrate.Migrator {
+	step := func(name string) func(context.Context, *mongo.Database) error {
+		return func(context.Context, *mongo.Database) error {
+			*calls = append(*calls, name)
+			return nil
+		}
+	}
+
+	return migrate.New(mt.DB,
+		migrate.Migration{ID: "002_second", Up: step("up 002"), Down: step("down 002")},
+		migrate.Migration{ID: "001_first", Description: "first", Up: step("up 001"), Down: step("down 001")},
+	)
+}
+
+func appliedResponse(ids ...string) bson.D {
+	docs := []bson.D{}
+	for _, id := range ids {
+		docs = append(docs, bson.D{{Key: "_id", Value: id}, {Key: "applied_at", Value: time.Now()}})
+	}
+
+	return mtest.CreateCursorResponse(0, "db.migrations", mtest.FirstBatch, docs...)
+}
+
+func TestMigrate(t *testing.T) {
+	runMock(t, func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			appliedResponse("001_first"),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		)
+
+		var calls []string
+		ids, err := newMigrator(mt, &calls).Migrate(context.Background())
+		util.AssertErrIsNil(t, err)
+
+		require.Equal(t, []string{"002_second"}, ids)
+		require.Equal(t, []string{"up 002"}, calls)
+
+		lock := mt.GetStartedEvent()
+		require.Equal(t, "update", lock.CommandName)
+		require.Equal(t, "migrations_lock", lock.Command.Lookup("update").StringValue())
+		require.Equal(t, "find", mt.GetStartedEvent().CommandName)
+
+		insert := mt.GetStartedEvent()
+		require.Equal(t, "insert", insert.CommandName)
+		require.Equal(t, "002_second", insert.Command.Lookup("documents").Array().Index(0).Value().Document().Lookup("_id").StringValue())
+
+		unlock := mt.GetStartedEvent()
+		require.Equal(t, "delete", unlock.CommandName)
+		require.Equal(t, "migrations_lock", unlock.Command.Lookup("delete").StringValue())
+	})
+}
+
+func TestMigrateTransactional(t *testing.T) {
+	runMock(t, func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			appliedResponse(),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		)
+
+		m := migrate.New(mt.DB, migrate.Migration{
+			ID:            "001_first",
+			Transactional: true,
+			Up:            func(context.Context, *mongo.Database) error { return nil },
+		})
+
+		_, err := m.Migrate(context.Background())
+		util.AssertErrIsNil(t, err)
+
+		var commands []string
+		for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+			commands = append(commands, evt.CommandName)
+		}
+		require.Equal(t, []string{"update", "find", "insert", "commitTransaction", "delete"}, commands)
+	})
+}
+
+func TestMigrateLocked(t *testing.T) {
+	runMock(t, func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"}))
+
+		var calls []string
+		_, err := newMigrator(mt, &calls).Migrate(context.Background())
+
+		require.Equal(t, migrate.ErrLocked, err)
+		require.Empty(t, calls)
+	})
+}
+
+func TestMigrateLockLost(t *testing.T) {
+	runMock(t, func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			appliedResponse(),
+			// The renewal doesn't match the lock, another instance took it.
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}),
+		)
+
+		up := func(ctx context.Context, _ *mongo.Database) error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+				return nil
+			}
+		}
+
+		m := migrate.New(mt.DB, migrate.Migration{ID: "001_slow", Up: up})
+		m.LockTTL = 30 * time.Millisecond
+
+		ids, err := m.Migrate(context.Background())
+		require.Equal(t, migrate.ErrLockLost, err)
+		require.Empty(t, ids)
+
+		require.Equal(t, "update", mt.GetStartedEvent().CommandName)
+		require.Equal(t, "find", mt.GetStartedEvent().CommandName)
+
+		renew := mt.GetStartedEvent()
+		require.Equal(t, "update", renew.CommandName)
+		q := renew.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+		require.Equal(t, "lock", q.Lookup("_id").StringValue())
+		require.NotEmpty(t, q.Lookup("owner").StringValue())
+
+		require.Equal(t, "delete", mt.GetStartedEvent().CommandName)
+	})
+}
+
+func TestRollback(t *testing.T) {
+	runMock(t, func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			appliedResponse("001_first", "002_second"),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		)
+
+		var calls []string
+		ids, err := newMigrator(mt, &calls).Rollback(context.Background(), 1)
+		util.AssertErrIsNil(t, err)
+
+		require.Equal(t, []string{"002_second"}, ids)
+		require.Equal(t, []string{"down 002"}, calls)
+	})
+}
+
+func TestRunStatus(t *testing.T) {
+	runMock(t, func(mt *mtest.T) {
+		mt.AddMockResponses(appliedResponse("001_first"))
+
+		var calls []string
+		out := &bytes.Buffer{}
+		util.AssertErrIsNil(t, migrate.Run(context.Background(), newMigrator(mt, &calls), []string{"status"}, out))
+
+		lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+		require.Len(t, lines, 3)
+		require.Contains(t, string(lines[1]), "001_first")
+		require.Contains(t, string(lines[1]), "first")
+		require.Contains(t, string(lines[2]), "002_second")
+		require.Contains(t, string(lines[2]), "pending")
+	})
+}
+
+func TestRunUnknownCommand(t *testing.T) {
+	require.Error(t, migrate.Run(context.Background(), migrate.New(nil), []string{"sideways"}, &bytes.Buffer{}))
+}
@@ -1,5 +1,14 @@
 package mgm
 
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
 // CollectionGetter interface contains a method to return
 // a model's custom collection.
 type CollectionGetter interface {
@@ -14,6 +23,22 @@ type CollectionNameGetter interface {
 	CollectionName() string
 }
 
+// ConnectionNameGetter interface contains a method to return
+// the name of the connection a model's collection belongs to.
+// Coll panics if the connection is not registered.
+type ConnectionNameGetter interface {
+	// ConnectionName method returns the model connection's name.
+	ConnectionName() string
+}
+
+// IndexesGetter interface contains a method to return the indexes
+// of a model's collection, in addition to the indexes declared by
+// the `mgm` tags of the model's fields.
+type IndexesGetter interface {
+	// Indexes method returns the model collection's indexes.
+	Indexes() []mongo.IndexModel
+}
+
 // Model interface contains base methods that must be implemented by
 // each model. If you're using the `DefaultModel` struct in your model,
 // you don't need to implement any of these methods.
@@ -26,6 +51,58 @@ type Model interface {
 	SetID(id interface{})
 }
 
+// SoftDeletable interface is implemented by models that should be soft
+// deleted. If you're using the `SoftDeleteFields` struct in your model,
+// you don't need to implement any of these methods.
+type SoftDeletable interface {
+	GetDeletedAt() *time.Time
+	SetDeletedAt(t *time.Time)
+}
+
+// Versioned interface is implemented by models that use optimistic
+// concurrency control on update. If you're using the `VersionField`
+// struct in your model, you don't need to implement any of these methods.
+type Versioned interface {
+	GetVersion() int64
+	SetVersion(v int64)
+}
+
+// Revisioned interface is implemented by models that keep the revisions of their
+// documents, see RevisionPolicy. If you're using the `RevisionFields` struct in
+// your model, you don't need to implement this method, unless you want to change
+// the retention policy of the revisions.
+type Revisioned interface {
+	RevisionPolicy() RevisionPolicy
+}
+
+// Snapshotter interface is implemented by models that keep a snapshot of
+// their loaded state, so updating them only sends the changed fields.
+// If you're using the `SnapshotField` struct in your model, you don't
+// need to implement any of these methods.
+type Snapshotter interface {
+	Snapshot() bson.Raw
+	SetSnapshot(raw bson.Raw)
+}
+
+// ErrVersionConflict is the error that VersionConflictError matches using `errors.Is`.
+var ErrVersionConflict = errors.New("version conflict")
+
+// VersionConflictError is returned when updating a versioned model whose
+// version in the database has changed since it was loaded.
+type VersionConflictError struct {
+	ID      interface{}
+	Version int64
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("version conflict: model %v is not at version %d", e.ID, e.Version)
+}
+
+// Is reports whether the target is ErrVersionConflict.
+func (e *VersionConflictError) Is(target error) bool {
+	return target == ErrVersionConflict
+}
+
 // DefaultModel struct contains a model's default fields.
 type DefaultModel struct {
 	IDField    `bson:",inline"`
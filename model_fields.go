@@ -0,0 +1,127 @@
+package mgm
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+)
+
+// modelField describes a field of a model's document.
+type modelField struct {
+	// path is the field's dotted bson path.
+	path string
+	// index is the field's index sequence in the model's struct,
+	// as used by reflect.Value.FieldByIndex.
+	index []int
+	field reflect.StructField
+	bson  bsoncodec.StructTags
+	mgm   tagOptions
+}
+
+// tagOptions contains the options of a field's `mgm` tag,
+// e.g `mgm:"index,unique,ttl=3600"`.
+type tagOptions map[string]string
+
+func parseTagOptions(tag string) tagOptions {
+	opts := tagOptions{}
+
+	for _, item := range strings.Split(tag, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		key, val := item, ""
+		if i := strings.Index(item, "="); i != -1 {
+			key, val = item[:i], item[i+1:]
+		}
+		opts[key] = val
+	}
+
+	return opts
+}
+
+func (o tagOptions) has(key string) bool {
+	_, ok := o[key]
+	return ok
+}
+
+var modelFieldsCache sync.Map
+
+// modelFields returns the fields of a model's document, including the fields
+// of inline structs and (with a dotted path) the fields of nested structs.
+// The returned slice is shared, so callers must not modify it.
+func modelFields(t reflect.Type) []modelField {
+	t = indirectType(t)
+
+	if fields, ok := modelFieldsCache.Load(t); ok {
+		return fields.([]modelField)
+	}
+
+	fields, _ := modelFieldsCache.LoadOrStore(t, structFields(t, "", nil))
+	return fields.([]modelField)
+}
+
+func structFields(t reflect.Type, prefix string, index []int) []modelField {
+	var fields []modelField
+
+	if t.Kind() != reflect.Struct {
+		return fields
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		tags, err := bsoncodec.DefaultStructTagParser(sf)
+		if err != nil || tags.Skip {
+			continue
+		}
+
+		ft := indirectType(sf.Type)
+		fieldIndex := append(append([]int{}, index...), i)
+
+		if tags.Inline {
+			fields = append(fields, structFields(ft, prefix, fieldIndex)...)
+			continue
+		}
+
+		f := modelField{
+			path:  prefix + tags.Name,
+			index: fieldIndex,
+			field: sf,
+			bson:  tags,
+			mgm:   parseTagOptions(sf.Tag.Get("mgm")),
+		}
+		fields = append(fields, f)
+
+		if isNestedStruct(ft) {
+			fields = append(fields, structFields(ft, f.path+".", fieldIndex)...)
+		}
+	}
+
+	return fields
+}
+
+// isNestedStruct returns true if the type is a struct that is stored
+// as an embedded document (e.g not a time.Time or a bson primitive).
+func isNestedStruct(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || t == reflect.TypeOf(time.Time{}) {
+		return false
+	}
+
+	return !strings.HasPrefix(t.PkgPath(), "go.mongodb.org/")
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t
+}
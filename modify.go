@@ -0,0 +1,336 @@
+package mgm
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/uncle-gua/mgm/field"
+	"github.com/uncle-gua/mgm/operator"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Upsert inserts the model, or updates the document that has the same filter
+// fields (e.g "email"). The filter fields default to `_id`, so a model with a zero
+// ObjectID gets a new ID and is inserted. The model's creating or updating hooks
+// are called depending on whether the document exists, then its created or
+// updated hooks are called depending on what happened. The `_id` and `created_at`
+// fields are just set when inserting the document. The model gets the ID of the
+// inserted or updated document. The existing document of a Versioned model is
+// updated just like Update, so it returns a VersionConflictError if the document
+// has changed since the model's version.
+func (coll *Collection) Upsert(ctx context.Context, model Model, filterFields ...string) error {
+	// A model that gets a new ID has no document.
+	isNew := setUpsertID(model, filterFields)
+
+	filter, _, err := upsertDocument(model, filterFields)
+	if err != nil {
+		return err
+	}
+
+	var id interface{}
+	if !isNew {
+		if id, err = coll.findID(ctx, model, filter); err != nil {
+			return err
+		}
+	}
+
+	var stored bson.Raw
+	if id != nil {
+		model.SetID(id)
+		if stored, err = storedDocument(ctx, coll, model); err != nil {
+			return err
+		}
+		err = callToBeforeUpdateHooks(ctx, model)
+	} else {
+		err = callToBeforeCreateHooks(ctx, model)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The existing document of a versioned model is just updated at the model's
+	// version, so a concurrent change fails rather than being overwritten.
+	versioned, isVersioned := model.(Versioned)
+	isVersioned = isVersioned && id != nil
+
+	var version int64
+	if isVersioned {
+		version = versioned.GetVersion()
+		versioned.SetVersion(version + 1)
+	}
+
+	var res *mongo.UpdateResult
+	filter, doc, err := upsertDocument(model, filterFields)
+	if err == nil {
+		upsertOpt := options.Update().SetUpsert(true)
+		if isVersioned {
+			filter = append(filter, bson.E{Key: field.Version, Value: versionFilter(version)})
+			upsertOpt.SetUpsert(false)
+		}
+
+		res, err = updateOne(ctx, coll, model, filter, doc, []*options.UpdateOptions{upsertOpt})
+	}
+
+	if isVersioned && (err != nil || res.MatchedCount == 0) {
+		versioned.SetVersion(version)
+
+		if err == nil {
+			err = &VersionConflictError{ID: model.GetID(), Version: version}
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	auditOp := AuditUpdate
+	if res.UpsertedID != nil {
+		model.SetID(res.UpsertedID)
+		auditOp, stored = AuditCreate, nil
+	}
+
+	if err := recordChange(ctx, coll, model, auditOp, stored); err != nil {
+		return err
+	}
+
+	if err := takeSnapshot(model); err != nil {
+		return err
+	}
+
+	if res.UpsertedID != nil {
+		return callToAfterCreateHooks(ctx, model)
+	}
+
+	return callToAfterUpdateHooks(ctx, res, model)
+}
+
+// findID returns the ID of the document matching the filter, or nil
+// if there is no such document.
+func (coll *Collection) findID(ctx context.Context, model Model, filter interface{}) (interface{}, error) {
+	var doc struct {
+		ID interface{} `bson:"_id"`
+	}
+
+	opts := []*options.FindOneOptions{options.FindOne().SetProjection(bson.M{field.ID: 1})}
+	op := &OpInfo{Op: OpFirst, Filter: filter, Model: model, Options: opts}
+
+	err := coll.intercept(ctx, op, func(ctx context.Context, op *OpInfo) error {
+		opts, err := opOptions[*options.FindOneOptions](op)
+		if err != nil {
+			return err
+		}
+
+		return coll.collection(ctx).FindOne(ctx, op.Filter, opts...).Decode(&doc)
+	})
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+
+	return doc.ID, err
+}
+
+// FindOneAndUpdate updates the first document matching the filter and decodes it
+// to the model. The model is the document before the update, unless the options
+// return the document after it. The model's finding hooks are called before the
+// update, then its found, updated and saved hooks are called. It returns
+// ErrNotRecorded for auditable and revisioned models.
+func (coll *Collection) FindOneAndUpdate(ctx context.Context, filter, update interface{}, model Model, opts ...*options.FindOneAndUpdateOptions) error {
+	if isRecorded(model) {
+		return ErrNotRecorded
+	}
+
+	if err := callToFindingHooks(ctx, model); err != nil {
+		return err
+	}
+
+	op := &OpInfo{Op: OpFindOneAndUpdate, Filter: coll.forModel(model).scopeFilter(filter), Update: update, Model: model, Options: opts}
+
+	err := coll.intercept(ctx, op, func(ctx context.Context, op *OpInfo) error {
+		opts, err := opOptions[*options.FindOneAndUpdateOptions](op)
+		if err != nil {
+			return err
+		}
+
+		return coll.collection(ctx).FindOneAndUpdate(ctx, op.Filter, op.Update, opts...).Decode(op.Model)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	after := options.MergeFindOneAndUpdateOptions(opts...).ReturnDocument
+	if err := foundModified(ctx, model, after); err != nil {
+		return err
+	}
+
+	return callToAfterUpdateHooks(ctx, &mongo.UpdateResult{MatchedCount: 1}, model)
+}
+
+// FindOneAndReplace replaces the first document matching the filter with the model,
+// then decodes the replaced document to the model. The model is the document before
+// the replace, unless the options return the document after it. The model's updating,
+// saving, updated and saved hooks are called. It returns ErrNotRecorded for
+// auditable and revisioned models.
+func (coll *Collection) FindOneAndReplace(ctx context.Context, filter interface{}, model Model, opts ...*options.FindOneAndReplaceOptions) error {
+	if isRecorded(model) {
+		return ErrNotRecorded
+	}
+
+	if err := callToBeforeUpdateHooks(ctx, model); err != nil {
+		return err
+	}
+
+	op := &OpInfo{Op: OpFindOneAndReplace, Filter: coll.forModel(model).scopeFilter(filter), Update: model, Model: model, Options: opts}
+
+	err := coll.intercept(ctx, op, func(ctx context.Context, op *OpInfo) error {
+		opts, err := opOptions[*options.FindOneAndReplaceOptions](op)
+		if err != nil {
+			return err
+		}
+
+		return coll.collection(ctx).FindOneAndReplace(ctx, op.Filter, op.Update, opts...).Decode(op.Model)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := setSnapshot(model, options.MergeFindOneAndReplaceOptions(opts...).ReturnDocument); err != nil {
+		return err
+	}
+
+	return callToAfterUpdateHooks(ctx, &mongo.UpdateResult{MatchedCount: 1}, model)
+}
+
+// FindOneAndDelete deletes the first document matching the filter and decodes it
+// to the model. Models that implement SoftDeletable are soft deleted. The model's
+// finding and deleting hooks are called before the delete, then its found and
+// deleted hooks are called. The deletes of auditable and revisioned models are recorded, so
+// they can't use a projection.
+func (coll *Collection) FindOneAndDelete(ctx context.Context, filter interface{}, model Model, opts ...*options.FindOneAndDeleteOptions) error {
+	if isRecorded(model) && options.MergeFindOneAndDeleteOptions(opts...).Projection != nil {
+		return ErrNotRecorded
+	}
+
+	if err := callToFindingHooks(ctx, model); err != nil {
+		return err
+	}
+
+	if err := callToBeforeDeleteHooks(ctx, model); err != nil {
+		return err
+	}
+
+	if _, ok := model.(SoftDeletable); ok {
+		return coll.findOneAndSoftDelete(ctx, filter, model, options.MergeFindOneAndDeleteOptions(opts...))
+	}
+
+	var stored bson.Raw
+	op := &OpInfo{Op: OpFindOneAndDelete, Filter: coll.scopeFilter(filter), Model: model, Options: opts}
+
+	err := coll.intercept(ctx, op, func(ctx context.Context, op *OpInfo) error {
+		opts, err := opOptions[*options.FindOneAndDeleteOptions](op)
+		if err != nil {
+			return err
+		}
+
+		res := coll.collection(ctx).FindOneAndDelete(ctx, op.Filter, opts...)
+		if err := res.Decode(op.Model); err != nil {
+			return err
+		}
+
+		stored, _ = res.DecodeBytes()
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := foundModified(ctx, model, nil); err != nil {
+		return err
+	}
+
+	if err := recordChange(ctx, coll, model, AuditDelete, stored); err != nil {
+		return err
+	}
+
+	return callToAfterDeleteHooks(ctx, &mongo.DeleteResult{DeletedCount: 1}, model)
+}
+
+func (coll *Collection) findOneAndSoftDelete(ctx context.Context, filter interface{}, model Model, opt *options.FindOneAndDeleteOptions) error {
+	now := time.Now().UTC()
+	update := bson.M{operator.Set: bson.M{field.DeletedAt: now}}
+
+	updateOpt := options.FindOneAndUpdate()
+	updateOpt.Collation = opt.Collation
+	updateOpt.MaxTime = opt.MaxTime
+	updateOpt.Projection = opt.Projection
+	updateOpt.Sort = opt.Sort
+	updateOpt.Hint = opt.Hint
+
+	// Soft-deleted documents can't be deleted again.
+	scoped := *coll.forModel(model)
+	scoped.trashed = withoutTrashed
+	op := &OpInfo{Op: OpFindOneAndUpdate, Filter: scoped.scopeFilter(filter), Update: update, Model: model, Options: []*options.FindOneAndUpdateOptions{updateOpt}}
+
+	var stored bson.Raw
+	err := coll.intercept(ctx, op, func(ctx context.Context, op *OpInfo) error {
+		opts, err := opOptions[*options.FindOneAndUpdateOptions](op)
+		if err != nil {
+			return err
+		}
+
+		res := coll.collection(ctx).FindOneAndUpdate(ctx, op.Filter, op.Update, opts...)
+		if err := res.Decode(op.Model); err != nil {
+			return err
+		}
+
+		stored, _ = res.DecodeBytes()
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := foundModified(ctx, model, nil); err != nil {
+		return err
+	}
+
+	model.(SoftDeletable).SetDeletedAt(&now)
+
+	if err := recordChange(ctx, coll, model, AuditDelete, stored); err != nil {
+		return err
+	}
+
+	return callToAfterDeleteHooks(ctx, &mongo.DeleteResult{DeletedCount: 1}, model)
+}
+
+// foundModified takes the snapshot of a model that is decoded by a find and
+// modify operation, then calls its found hooks.
+func foundModified(ctx context.Context, model Model, returnDocument *options.ReturnDocument) error {
+	if err := setSnapshot(model, returnDocument); err != nil {
+		return err
+	}
+
+	return callToFoundHooks(ctx, model)
+}
+
+// setSnapshot takes the snapshot of a model that is decoded by a find and modify
+// operation. The document before the operation is not the stored document, so
+// the model's snapshot is removed.
+func setSnapshot(model Model, returnDocument *options.ReturnDocument) error {
+	if returnDocument != nil && *returnDocument == options.After {
+		return takeSnapshot(model)
+	}
+
+	if s, ok := model.(Snapshotter); ok {
+		s.SetSnapshot(nil)
+	}
+
+	return nil
+}
@@ -0,0 +1,258 @@
+package mgm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uncle-gua/mgm"
+	"github.com/uncle-gua/mgm/internal/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestUpsertInserts(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "models.tickets", mtest.FirstBatch),
+			mtest.CreateSuccessResponse(
+				bson.E{Key: "n", Value: 1},
+				bson.E{Key: "upserted", Value: bson.A{bson.D{{Key: "index", Value: 0}, {Key: "_id", Value: id}}}},
+			),
+		)
+
+		ticket := &Ticket{Email: "a@x.io"}
+		util.AssertErrIsNil(t, coll.Upsert(context.Background(), ticket, "email"))
+
+		require.Equal(t, "a@x.io", mt.GetStartedEvent().Command.Lookup("filter", "email").StringValue())
+
+		upd := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		require.True(t, upd.Lookup("upsert").Boolean())
+		require.Equal(t, "a@x.io", upd.Lookup("q", "email").StringValue())
+		require.Equal(t, bson.TypeDateTime, upd.Lookup("u", "$setOnInsert", "created_at").Type)
+
+		require.Equal(t, id, ticket.ID)
+		require.False(t, ticket.CreatedAt.IsZero())
+		require.Equal(t, 1, ticket.created)
+		require.Equal(t, 0, ticket.updated)
+	})
+}
+
+func TestUpsertByID(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(
+			bson.E{Key: "n", Value: 1},
+			bson.E{Key: "upserted", Value: bson.A{bson.D{{Key: "index", Value: 0}, {Key: "_id", Value: primitive.NewObjectID()}}}},
+		))
+
+		ticket := &Ticket{Email: "a@x.io"}
+		util.AssertErrIsNil(t, coll.Upsert(context.Background(), ticket))
+
+		// The new model gets an ID rather than upserting `{_id: null}`, and it isn't looked up.
+		evt := mt.GetStartedEvent()
+		require.Equal(t, "update", evt.CommandName)
+
+		upd := evt.Command.Lookup("updates").Array().Index(0).Value().Document()
+		require.Equal(t, bson.TypeObjectID, upd.Lookup("q", "_id").Type)
+		require.Equal(t, upd.Lookup("q", "_id"), upd.Lookup("u", "$setOnInsert", "_id"))
+
+		require.Equal(t, 1, ticket.created)
+		require.Equal(t, 0, ticket.updated)
+	})
+}
+
+func TestUpsertUpdates(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "models.tickets", mtest.FirstBatch, bson.D{{Key: "_id", Value: id}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+
+		ticket := &Ticket{Email: "a@x.io"}
+		util.AssertErrIsNil(t, coll.Upsert(context.Background(), ticket, "email"))
+
+		mt.GetStartedEvent()
+		upd := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		require.Equal(t, id, upd.Lookup("u", "$setOnInsert", "_id").ObjectID())
+		require.Equal(t, bson.TypeDateTime, upd.Lookup("u", "$set", "updated_at").Type)
+
+		require.Equal(t, id, ticket.ID)
+		require.True(t, ticket.CreatedAt.IsZero())
+		require.Equal(t, 0, ticket.created)
+		require.Equal(t, 1, ticket.updated)
+	})
+}
+
+func TestUpsertVersioned(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		order := &Order{Total: 10}
+		order.ID = primitive.NewObjectID()
+		order.Version = 3
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "models.orders", mtest.FirstBatch, bson.D{{Key: "_id", Value: order.ID}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+
+		util.AssertErrIsNil(t, coll.Upsert(context.Background(), order))
+		require.Equal(t, int64(4), order.Version)
+
+		mt.GetStartedEvent()
+		upd := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		require.Equal(t, order.ID, upd.Lookup("q", "_id").ObjectID())
+		require.Equal(t, int64(3), upd.Lookup("q", "_v").AsInt64())
+		require.Equal(t, int64(4), upd.Lookup("u", "$set", "_v").AsInt64())
+		require.False(t, upd.Lookup("upsert").Boolean())
+	})
+}
+
+func TestUpsertVersionConflict(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		order := &Order{Total: 10}
+		order.ID = primitive.NewObjectID()
+		order.Version = 3
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "models.orders", mtest.FirstBatch, bson.D{{Key: "_id", Value: order.ID}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}),
+		)
+
+		err := coll.Upsert(context.Background(), order)
+		require.True(t, errors.Is(err, mgm.ErrVersionConflict))
+
+		var conflict *mgm.VersionConflictError
+		require.True(t, errors.As(err, &conflict))
+		require.Equal(t, int64(3), conflict.Version)
+		require.Equal(t, int64(3), order.Version)
+	})
+}
+
+func TestUpsertInsertsVersioned(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(
+			bson.E{Key: "n", Value: 1},
+			bson.E{Key: "upserted", Value: bson.A{bson.D{{Key: "index", Value: 0}, {Key: "_id", Value: primitive.NewObjectID()}}}},
+		))
+
+		order := &Order{Total: 10}
+		util.AssertErrIsNil(t, coll.Upsert(context.Background(), order))
+		require.Equal(t, int64(0), order.Version)
+
+		upd := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		require.True(t, upd.Lookup("upsert").Boolean())
+		_, err := upd.LookupErr("q", "_v")
+		require.Error(t, err)
+	})
+}
+
+func TestFindOneAndUpdate(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(mtest.CreateSuccessResponse(
+			bson.E{Key: "value", Value: bson.D{{Key: "_id", Value: id}, {Key: "email", Value: "b@x.io"}}},
+		))
+
+		ticket := &Ticket{}
+		update := bson.M{"$set": bson.M{"email": "b@x.io"}}
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		util.AssertErrIsNil(t, coll.FindOneAndUpdate(context.Background(), bson.M{"email": "a@x.io"}, update, ticket, opts))
+
+		evt := mt.GetStartedEvent()
+		require.Equal(t, "findAndModify", evt.CommandName)
+		require.True(t, evt.Command.Lookup("new").Boolean())
+
+		require.Equal(t, id, ticket.ID)
+		require.Equal(t, "b@x.io", ticket.Email)
+		require.Equal(t, 1, ticket.updated)
+	})
+}
+
+func TestFindOneAndReplace(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(
+			bson.E{Key: "value", Value: bson.D{{Key: "email", Value: "a@x.io"}}},
+		))
+
+		ticket := &Ticket{Email: "b@x.io"}
+		util.AssertErrIsNil(t, coll.FindOneAndReplace(context.Background(), bson.M{"email": "a@x.io"}, ticket))
+
+		evt := mt.GetStartedEvent()
+		require.Equal(t, "b@x.io", evt.Command.Lookup("update", "email").StringValue())
+		require.Equal(t, bson.TypeDateTime, evt.Command.Lookup("update", "updated_at").Type)
+
+		// The model is the document before the replace.
+		require.Equal(t, "a@x.io", ticket.Email)
+		require.Equal(t, 1, ticket.updated)
+	})
+}
+
+func TestFindOneAndDelete(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(
+			bson.E{Key: "value", Value: bson.D{{Key: "email", Value: "a@x.io"}}},
+		))
+
+		ticket := &Ticket{}
+		util.AssertErrIsNil(t, coll.FindOneAndDelete(context.Background(), bson.M{"email": "a@x.io"}, ticket))
+
+		require.True(t, mt.GetStartedEvent().Command.Lookup("remove").Boolean())
+		require.Equal(t, "a@x.io", ticket.Email)
+		require.Equal(t, 1, ticket.deleting)
+		require.Equal(t, 1, ticket.deleted)
+	})
+}
+
+func TestFindOneAndDeleteSoftDeletes(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(
+			bson.E{Key: "value", Value: bson.D{{Key: "title", Value: "hello"}}},
+		))
+
+		post := &Post{}
+		util.AssertErrIsNil(t, softColl(coll).FindOneAndDelete(context.Background(), bson.M{"title": "hello"}, post))
+
+		cmd := mt.GetStartedEvent().Command
+		require.Equal(t, bson.TypeDateTime, cmd.Lookup("update", "$set", "deleted_at").Type)
+
+		require.Equal(t, "hello", post.Title)
+		require.True(t, post.IsDeleted())
+		require.Equal(t, 1, post.deleting)
+		require.Equal(t, int64(1), post.deleted.DeletedCount)
+	})
+}
+
+func TestReplace(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		ticket := &Ticket{Email: "a@x.io"}
+		ticket.ID = primitive.NewObjectID()
+		util.AssertErrIsNil(t, coll.ReplaceWithCtx(context.Background(), ticket))
+
+		upd := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		require.Equal(t, ticket.ID, upd.Lookup("q", "_id").ObjectID())
+		require.Equal(t, "a@x.io", upd.Lookup("u", "email").StringValue())
+		_, err := upd.LookupErr("u", "$set")
+		require.Error(t, err)
+
+		require.Equal(t, 1, ticket.updated)
+	})
+}
+
+func TestReplaceVersionConflict(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}))
+
+		order := &Order{}
+		order.Version = 2
+
+		err := coll.ReplaceWithCtx(context.Background(), order)
+		require.True(t, errors.Is(err, mgm.ErrVersionConflict))
+		require.Equal(t, int64(2), order.Version)
+	})
+}
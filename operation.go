@@ -2,9 +2,11 @@ package mgm
 
 import (
 	"context"
+	"time"
 
 	"github.com/uncle-gua/mgm/field"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -14,7 +16,18 @@ func create(ctx context.Context, coll *Collection, model Model, opts ...*options
 		return err
 	}
 
-	res, err := coll.c.InsertOne(ctx, model, opts...)
+	var res *mongo.InsertOneResult
+	op := &OpInfo{Op: OpInsert, Model: model, Options: opts}
+
+	err := coll.intercept(ctx, op, func(ctx context.Context, op *OpInfo) (err error) {
+		opts, err := opOptions[*options.InsertOneOptions](op)
+		if err != nil {
+			return err
+		}
+
+		res, err = coll.collection(ctx).InsertOne(ctx, op.Model, opts...)
+		return err
+	})
 
 	if err != nil {
 		return err
@@ -23,36 +36,334 @@ func create(ctx context.Context, coll *Collection, model Model, opts ...*options
 	// Set new id
 	model.SetID(res.InsertedID)
 
+	if err := recordChange(ctx, coll, model, AuditCreate, nil); err != nil {
+		return err
+	}
+
+	if err := takeSnapshot(model); err != nil {
+		return err
+	}
+
 	return callToAfterCreateHooks(ctx, model)
 }
 
 func first(ctx context.Context, coll *Collection, filter interface{}, model Model, opts ...*options.FindOneOptions) error {
-	return coll.c.FindOne(ctx, filter, opts...).Decode(model)
+	if err := callToFindingHooks(ctx, model); err != nil {
+		return err
+	}
+
+	op := &OpInfo{Op: OpFirst, Filter: coll.forModel(model).scopeFilter(filter), Model: model, Options: opts}
+
+	err := coll.intercept(ctx, op, func(ctx context.Context, op *OpInfo) error {
+		opts, err := opOptions[*options.FindOneOptions](op)
+		if err != nil {
+			return err
+		}
+
+		return coll.collection(ctx).FindOne(ctx, op.Filter, opts...).Decode(op.Model)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// The snapshot is the stored document, so changes made by the
+	// found hooks (e.g back-filled defaults) are persisted on update.
+	if err := takeSnapshot(model); err != nil {
+		return err
+	}
+
+	return callToFoundHooks(ctx, model)
 }
 
 func update(ctx context.Context, coll *Collection, model Model, opts ...*options.UpdateOptions) error {
+	return updateFields(ctx, coll, model, nil, opts...)
+}
+
+// updateFields updates the model. If fields is nil, it updates the fields
+// changed since the model's snapshot (or the whole model), otherwise just
+// the specified fields and the fields changed by the hooks.
+func updateFields(ctx context.Context, coll *Collection, model Model, fields []string, opts ...*options.UpdateOptions) error {
+	var before bson.Raw
+
+	if fields != nil {
+		var err error
+		if before, err = bson.Marshal(model); err != nil {
+			return err
+		}
+	}
+
+	stored, err := storedDocument(ctx, coll, model)
+	if err != nil {
+		return err
+	}
+
 	// Call to saving hook
 	if err := callToBeforeUpdateHooks(ctx, model); err != nil {
 		return err
 	}
 
-	res, err := coll.c.UpdateOne(ctx, bson.M{field.ID: model.GetID()}, bson.M{"$set": model}, opts...)
+	filter := bson.M{field.ID: model.GetID()}
+
+	versioned, isVersioned := model.(Versioned)
+	var version int64
+
+	if isVersioned {
+		version = versioned.GetVersion()
+		filter[field.Version] = versionFilter(version)
+		versioned.SetVersion(version + 1)
+	}
+
+	doc, err := updateDocument(model, fields, before, opts)
+
+	var res *mongo.UpdateResult
+	if err == nil && len(doc) == 0 {
+		// Nothing has changed, so there is nothing to send.
+		res = &mongo.UpdateResult{}
+	} else if err == nil {
+		res, err = updateOne(ctx, coll, model, filter, doc, opts)
+	}
+
+	if isVersioned && (err != nil || res.MatchedCount == 0 && res.UpsertedCount == 0) {
+		versioned.SetVersion(version)
+
+		if err == nil {
+			err = &VersionConflictError{ID: model.GetID(), Version: version}
+		}
+	}
 
 	if err != nil {
 		return err
 	}
 
+	if err := recordChange(ctx, coll, model, AuditUpdate, stored); err != nil {
+		return err
+	}
+
+	if err := takeSnapshot(model); err != nil {
+		return err
+	}
+
 	return callToAfterUpdateHooks(ctx, res, model)
 }
 
+// replace replaces the model's document with the whole model.
+func replace(ctx context.Context, coll *Collection, model Model, opts ...*options.ReplaceOptions) error {
+	stored, err := storedDocument(ctx, coll, model)
+	if err != nil {
+		return err
+	}
+
+	if err := callToBeforeUpdateHooks(ctx, model); err != nil {
+		return err
+	}
+
+	filter := bson.M{field.ID: model.GetID()}
+
+	versioned, isVersioned := model.(Versioned)
+	var version int64
+
+	if isVersioned {
+		version = versioned.GetVersion()
+		filter[field.Version] = versionFilter(version)
+		versioned.SetVersion(version + 1)
+	}
+
+	var res *mongo.UpdateResult
+	op := &OpInfo{Op: OpReplace, Filter: filter, Update: model, Model: model, Options: opts}
+
+	err = coll.intercept(ctx, op, func(ctx context.Context, op *OpInfo) (err error) {
+		opts, err := opOptions[*options.ReplaceOptions](op)
+		if err != nil {
+			return err
+		}
+
+		res, err = coll.collection(ctx).ReplaceOne(ctx, op.Filter, op.Update, opts...)
+		return err
+	})
+
+	if isVersioned && (err != nil || res.MatchedCount == 0 && res.UpsertedCount == 0) {
+		versioned.SetVersion(version)
+
+		if err == nil {
+			err = &VersionConflictError{ID: model.GetID(), Version: version}
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := recordChange(ctx, coll, model, AuditUpdate, stored); err != nil {
+		return err
+	}
+
+	if err := takeSnapshot(model); err != nil {
+		return err
+	}
+
+	return callToAfterUpdateHooks(ctx, res, model)
+}
+
+// versionFilter returns the filter value of a model's current version.
+// Documents stored before the model became versioned don't have the
+// version field, so they match version zero.
+func versionFilter(version int64) interface{} {
+	if version == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
+	}
+
+	return version
+}
+
 func del(ctx context.Context, coll *Collection, model Model) error {
+	if _, ok := model.(SoftDeletable); ok {
+		return softDel(ctx, coll, model)
+	}
+
+	return forceDel(ctx, coll, model)
+}
+
+func forceDel(ctx context.Context, coll *Collection, model Model) error {
 	if err := callToBeforeDeleteHooks(ctx, model); err != nil {
 		return err
 	}
-	res, err := coll.c.DeleteOne(ctx, bson.M{field.ID: model.GetID()})
+
+	stored, err := storedDocument(ctx, coll, model)
+	if err != nil {
+		return err
+	}
+
+	var res *mongo.DeleteResult
+	op := &OpInfo{Op: OpDelete, Filter: bson.M{field.ID: model.GetID()}, Model: model, Options: []*options.DeleteOptions{}}
+
+	err = coll.intercept(ctx, op, func(ctx context.Context, op *OpInfo) (err error) {
+		opts, err := opOptions[*options.DeleteOptions](op)
+		if err != nil {
+			return err
+		}
+
+		res, err = coll.collection(ctx).DeleteOne(ctx, op.Filter, opts...)
+		return err
+	})
+
 	if err != nil {
 		return err
 	}
 
+	if res.DeletedCount != 0 {
+		if err := recordChange(ctx, coll, model, AuditDelete, stored); err != nil {
+			return err
+		}
+	}
+
 	return callToAfterDeleteHooks(ctx, res, model)
 }
+
+func softDel(ctx context.Context, coll *Collection, model Model) error {
+	if err := callToBeforeDeleteHooks(ctx, model); err != nil {
+		return err
+	}
+
+	stored, err := storedDocument(ctx, coll, model)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	filter := bson.M{field.ID: model.GetID(), field.DeletedAt: nil}
+
+	res, err := updateOne(ctx, coll, model, filter, bson.M{"$set": bson.M{field.DeletedAt: now}}, nil)
+	if err != nil {
+		return err
+	}
+
+	model.(SoftDeletable).SetDeletedAt(&now)
+
+	if res.ModifiedCount != 0 {
+		if err := recordChange(ctx, coll, model, AuditDelete, stored); err != nil {
+			return err
+		}
+	}
+
+	return callToAfterDeleteHooks(ctx, &mongo.DeleteResult{DeletedCount: res.ModifiedCount}, model)
+}
+
+func restore(ctx context.Context, coll *Collection, model Model) error {
+	sd, ok := model.(SoftDeletable)
+	if !ok {
+		return ErrNotSoftDeletable
+	}
+
+	stored, err := storedDocument(ctx, coll, model)
+	if err != nil {
+		return err
+	}
+
+	res, err := updateOne(ctx, coll, model, bson.M{field.ID: model.GetID()}, bson.M{"$unset": bson.M{field.DeletedAt: ""}}, nil)
+	if err != nil {
+		return err
+	}
+
+	sd.SetDeletedAt(nil)
+
+	if res.ModifiedCount != 0 && stored != nil {
+		// Only the deleted_at field changes, whatever the model's other fields are.
+		var doc bson.D
+		if err := bson.Unmarshal(stored, &doc); err != nil {
+			return err
+		}
+
+		restored := make(bson.D, 0, len(doc))
+		for _, e := range doc {
+			if e.Key != field.DeletedAt {
+				restored = append(restored, e)
+			}
+		}
+
+		after, err := bson.Marshal(restored)
+		if err != nil {
+			return err
+		}
+
+		return recordDocument(ctx, coll, model, AuditUpdate, stored, after)
+	}
+
+	return nil
+}
+
+// updateOne updates the model's document using the collection's interceptors.
+func updateOne(ctx context.Context, coll *Collection, model Model, filter, doc interface{}, opts []*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	var res *mongo.UpdateResult
+	op := &OpInfo{Op: OpUpdate, Filter: filter, Update: doc, Model: model, Options: opts}
+
+	err := coll.intercept(ctx, op, func(ctx context.Context, op *OpInfo) (err error) {
+		opts, err := opOptions[*options.UpdateOptions](op)
+		if err != nil {
+			return err
+		}
+
+		res, err = coll.collection(ctx).UpdateOne(ctx, op.Filter, op.Update, opts...)
+		return err
+	})
+
+	return res, err
+}
+
+// updateMany updates the documents matching the filter using the collection's interceptors.
+func updateMany(ctx context.Context, coll *Collection, filter, doc interface{}, opts []*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	var res *mongo.UpdateResult
+	op := &OpInfo{Op: OpUpdateMany, Filter: filter, Update: doc, Options: opts}
+
+	err := coll.intercept(ctx, op, func(ctx context.Context, op *OpInfo) (err error) {
+		opts, err := opOptions[*options.UpdateOptions](op)
+		if err != nil {
+			return err
+		}
+
+		res, err = coll.collection(ctx).UpdateMany(ctx, op.Filter, op.Update, opts...)
+		return err
+	})
+
+	return res, err
+}
@@ -0,0 +1,258 @@
+package mgm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/uncle-gua/mgm/builder"
+	"github.com/uncle-gua/mgm/field"
+	"github.com/uncle-gua/mgm/operator"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrNoSession is returned when emitting an outbox event outside of a session.
+var ErrNoSession = errors.New("outbox events must be emitted in a transaction's session")
+
+// ErrUnknownClient is returned when emitting an outbox event in the session of a
+// client that has no registered connection. Use the Emit method of a connection
+// to choose the outbox's database.
+var ErrUnknownClient = errors.New("session's client has no registered connection")
+
+// ErrLeaseLost is returned when a relay publishes an event whose lease has
+// expired and is claimed by another relay, so the event may be published twice.
+var ErrLeaseLost = errors.New("outbox event's lease is lost")
+
+// OutboxEvent is an event of the outbox collection. The relay publishes the
+// events that are not delivered in the order they are created.
+type OutboxEvent struct {
+	DefaultModel `bson:",inline"`
+
+	Topic string `json:"topic" bson:"topic"`
+	// Payload is the encoded payload, decode it using bson.Unmarshal.
+	Payload bson.Raw `json:"payload" bson:"payload"`
+	// Attempts is the number of times the event is claimed by a relay.
+	Attempts  int    `json:"attempts" bson:"attempts"`
+	LastError string `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	// LeaseUntil is the time until which a relay owns the event.
+	LeaseUntil  *time.Time `json:"lease_until" bson:"lease_until"`
+	DeliveredAt *time.Time `json:"delivered_at" bson:"delivered_at" mgm:"index"`
+}
+
+// CollectionName returns the name of the outbox collection.
+func (e *OutboxEvent) CollectionName() string {
+	return "outbox"
+}
+
+// Emit writes an event to the outbox collection using the context's session, so
+// the event is written if and only if the transaction commits. Call it in the
+// hooks of models (e.g the Created hook) or in a TransactionWithCtx function.
+// The payload must be a document (e.g a struct or a map). The event is written
+// to the database of the session's connection, the registered connection that
+// has the session's client (the default connection first). It returns
+// ErrUnknownClient if no registered connection has the client.
+func Emit(ctx context.Context, topic string, payload interface{}) error {
+	session := mongo.SessionFromContext(ctx)
+	if session == nil {
+		return ErrNoSession
+	}
+
+	conn := clientConnection(session.Client())
+	if conn == nil {
+		return ErrUnknownClient
+	}
+
+	return conn.Emit(ctx, topic, payload)
+}
+
+// Emit writes an event to the outbox collection of the connection's database
+// using the context's session, see the Emit function.
+func (conn *Connection) Emit(ctx context.Context, topic string, payload interface{}) error {
+	if mongo.SessionFromContext(ctx) == nil {
+		return ErrNoSession
+	}
+
+	raw, err := bson.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	event := &OutboxEvent{Topic: topic, Payload: raw}
+
+	return conn.Coll(event).CreateWithCtx(ctx, event)
+}
+
+// Publisher publishes the outbox events, e.g to a message broker.
+type Publisher interface {
+	Publish(ctx context.Context, event *OutboxEvent) error
+}
+
+// ChannelPublisher is an in-memory publisher that sends the events to its channel.
+type ChannelPublisher struct {
+	Events chan *OutboxEvent
+}
+
+// NewChannelPublisher returns a new channel publisher with a channel of the given size.
+func NewChannelPublisher(size int) *ChannelPublisher {
+	return &ChannelPublisher{Events: make(chan *OutboxEvent, size)}
+}
+
+// Publish sends the event to the publisher's channel.
+func (p *ChannelPublisher) Publish(ctx context.Context, event *OutboxEvent) error {
+	select {
+	case p.Events <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RelayOptions are the options of an outbox relay.
+type RelayOptions struct {
+	// Lease is how long a relay owns a claimed event before other relays
+	// can claim it, it defaults to 30s.
+	Lease time.Duration
+	// PollInterval is the wait when there are no events to publish, it defaults to 1s.
+	PollInterval time.Duration
+	// RetryDelay is the wait before retrying an event that failed to publish, it
+	// doubles on each attempt up to the Lease. It defaults to 1s.
+	RetryDelay time.Duration
+	// MaxAttempts is the number of attempts to publish an event, zero retries forever.
+	MaxAttempts int
+	// OnError is called with the errors of the relay's Run method.
+	OnError func(err error)
+}
+
+// Relay publishes the events of the outbox collection. Many relays can run at
+// once: each event is claimed by a single relay using a lease.
+type Relay struct {
+	coll      *Collection
+	publisher Publisher
+	opts      RelayOptions
+}
+
+// NewRelay returns a new relay that publishes the outbox events using the publisher.
+// The opts can be nil.
+func NewRelay(publisher Publisher, opts *RelayOptions) *Relay {
+	r := &Relay{coll: Coll(&OutboxEvent{}), publisher: publisher}
+	if opts != nil {
+		r.opts = *opts
+	}
+
+	if r.opts.Lease == 0 {
+		r.opts.Lease = 30 * time.Second
+	}
+	if r.opts.PollInterval == 0 {
+		r.opts.PollInterval = time.Second
+	}
+	if r.opts.RetryDelay == 0 {
+		r.opts.RetryDelay = time.Second
+	}
+
+	return r
+}
+
+// Run publishes the outbox events until the context is done.
+func (r *Relay) Run(ctx context.Context) error {
+	for {
+		relayed, err := r.RelayOnce(ctx)
+		if err != nil && ctx.Err() == nil && r.opts.OnError != nil {
+			r.opts.OnError(err)
+		}
+
+		if relayed && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.opts.PollInterval):
+		}
+	}
+}
+
+// RelayOnce claims the oldest event that is not delivered, publishes it and marks
+// it as delivered. It returns false if there is no event to publish. An event
+// that fails to publish is retried after the retry delay. If the event's lease
+// expires while publishing it, it returns ErrLeaseLost.
+func (r *Relay) RelayOnce(ctx context.Context) (bool, error) {
+	event, err := r.claim(ctx)
+	if err != nil || event == nil {
+		return false, err
+	}
+
+	// The event is just updated while the relay owns it.
+	filter := bson.M{field.ID: event.ID, "lease_until": event.LeaseUntil}
+
+	if err := r.publisher.Publish(ctx, event); err != nil {
+		retryAt := time.Now().UTC().Add(r.retryDelay(event.Attempts))
+		upd := builder.Update().Set("last_error", err.Error()).Set("lease_until", retryAt)
+
+		if _, err := r.coll.UpdateOneWhere(ctx, filter, upd); err != nil {
+			return true, err
+		}
+
+		return true, fmt.Errorf("publish outbox event %s: %w", event.ID.Hex(), err)
+	}
+
+	now := time.Now().UTC()
+	upd := builder.Update().Set("delivered_at", now).Unset("lease_until", "last_error")
+
+	res, err := r.coll.UpdateOneWhere(ctx, filter, upd)
+	if err != nil {
+		return true, err
+	}
+	if res.MatchedCount == 0 {
+		return true, fmt.Errorf("deliver outbox event %s: %w", event.ID.Hex(), ErrLeaseLost)
+	}
+
+	return true, nil
+}
+
+// claim leases the oldest event that is not delivered, or returns nil if there is no such event.
+func (r *Relay) claim(ctx context.Context) (*OutboxEvent, error) {
+	now := time.Now().UTC()
+
+	filter := bson.M{
+		"delivered_at": nil,
+		operator.Or:    bson.A{bson.M{"lease_until": nil}, bson.M{"lease_until": bson.M{operator.Lte: now}}},
+	}
+	if r.opts.MaxAttempts > 0 {
+		filter["attempts"] = bson.M{operator.Lt: r.opts.MaxAttempts}
+	}
+
+	upd := builder.Update().Set("lease_until", now.Add(r.opts.Lease)).Inc("attempts", 1)
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: field.CreatedAt, Value: 1}}).
+		SetReturnDocument(options.After)
+
+	event := &OutboxEvent{}
+
+	err := r.coll.FindOneAndUpdate(ctx, filter, upd.ToMap(), event, opts)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// retryDelay returns the wait before retrying an event after its attempts.
+func (r *Relay) retryDelay(attempts int) time.Duration {
+	d := r.opts.RetryDelay
+	for i := 1; i < attempts && d < r.opts.Lease; i++ {
+		d *= 2
+	}
+
+	if d > r.opts.Lease {
+		return r.opts.Lease
+	}
+
+	return d
+}
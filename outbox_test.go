@@ -0,0 +1,195 @@
+package mgm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uncle-gua/mgm"
+	"github.com/uncle-gua/mgm/internal/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+type Invoice struct {
+	mgm.DefaultModel `bson:",inline"`
+
+	Total int `bson:"total"`
+}
+
+func (i *Invoice) Created(ctx context.Context) error {
+	return mgm.Emit(ctx, "invoice.created", bson.M{"invoice_id": i.ID, "total": i.Total})
+}
+
+type failingPublisher struct{}
+
+func (failingPublisher) Publish(ctx context.Context, event *mgm.OutboxEvent) error {
+	return errors.New("broker is down")
+}
+
+// leaseUntil is the lease of the claimed outbox events.
+var leaseUntil = time.Date(2022, 3, 1, 12, 0, 30, 0, time.UTC)
+
+func outboxEvent(id primitive.ObjectID) bson.D {
+	payload, _ := bson.Marshal(bson.M{"total": 10})
+
+	return bson.D{
+		{Key: "_id", Value: id},
+		{Key: "topic", Value: "invoice.created"},
+		{Key: "payload", Value: bson.Raw(payload)},
+		{Key: "attempts", Value: 1},
+		{Key: "lease_until", Value: leaseUntil},
+	}
+}
+
+func TestEmitRequiresSession(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		err := mgm.Emit(context.Background(), "invoice.created", bson.M{})
+		require.True(t, errors.Is(err, mgm.ErrNoSession))
+	})
+}
+
+func TestEmitInTransaction(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)
+
+		invoice := &Invoice{Total: 10}
+		err := mgm.TransactionWithCtx(context.Background(), func(session mongo.Session, sc mongo.SessionContext) error {
+			return mgm.Coll(invoice).CreateWithCtx(sc, invoice)
+		})
+		util.AssertErrIsNil(t, err)
+
+		insert := mt.GetStartedEvent()
+		emit := mt.GetStartedEvent()
+		require.Equal(t, "insert", emit.CommandName)
+		require.Equal(t, "outbox", emit.Command.Lookup("insert").StringValue())
+		require.Equal(t, insert.Command.Lookup("lsid"), emit.Command.Lookup("lsid"))
+		require.Equal(t, insert.Command.Lookup("txnNumber"), emit.Command.Lookup("txnNumber"))
+
+		doc := emit.Command.Lookup("documents").Array().Index(0).Value().Document()
+		require.Equal(t, "invoice.created", doc.Lookup("topic").StringValue())
+		require.Equal(t, invoice.ID, doc.Lookup("payload", "invoice_id").ObjectID())
+
+		require.Equal(t, "commitTransaction", mt.GetStartedEvent().CommandName)
+		require.Nil(t, mt.GetStartedEvent())
+	})
+}
+
+func TestRelayOnce(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: outboxEvent(id)}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+
+		publisher := mgm.NewChannelPublisher(1)
+		relayed, err := mgm.NewRelay(publisher, nil).RelayOnce(context.Background())
+		util.AssertErrIsNil(t, err)
+		require.True(t, relayed)
+
+		event := <-publisher.Events
+		require.Equal(t, id, event.ID)
+		require.Equal(t, "invoice.created", event.Topic)
+		require.Equal(t, int32(10), event.Payload.Lookup("total").Int32())
+
+		claim := mt.GetStartedEvent().Command
+		require.Equal(t, bson.TypeNull, claim.Lookup("query", "delivered_at").Type)
+		require.Equal(t, int64(1), claim.Lookup("update", "$inc", "attempts").AsInt64())
+		require.Equal(t, bson.TypeDateTime, claim.Lookup("update", "$set", "lease_until").Type)
+
+		upd := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		require.Equal(t, id, upd.Lookup("q", "_id").ObjectID())
+		require.Equal(t, leaseUntil, upd.Lookup("q", "lease_until").Time().UTC())
+		require.Equal(t, bson.TypeDateTime, upd.Lookup("u", "$set", "delivered_at").Type)
+	})
+}
+
+func TestRelayOncePublishFailure(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: outboxEvent(primitive.NewObjectID())}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+
+		relayed, err := mgm.NewRelay(failingPublisher{}, nil).RelayOnce(context.Background())
+		require.True(t, relayed)
+		require.Error(t, err)
+
+		mt.GetStartedEvent()
+		upd := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		require.Equal(t, leaseUntil, upd.Lookup("q", "lease_until").Time().UTC())
+		require.Equal(t, "broker is down", upd.Lookup("u", "$set", "last_error").StringValue())
+		require.Equal(t, bson.TypeDateTime, upd.Lookup("u", "$set", "lease_until").Type)
+	})
+}
+
+func TestRelayOnceLeaseLost(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: outboxEvent(primitive.NewObjectID())}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}),
+		)
+
+		relayed, err := mgm.NewRelay(mgm.NewChannelPublisher(1), nil).RelayOnce(context.Background())
+		require.True(t, relayed)
+		require.True(t, errors.Is(err, mgm.ErrLeaseLost))
+	})
+}
+
+func TestEmitUsesSessionConnection(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		other, err := mongo.NewClient()
+		util.AssertErrIsNil(t, err)
+		mgm.RegisterConnection(mgm.NewConnection(mgm.DefaultConnectionName, nil, other, "db"))
+		mgm.RegisterConnection(mgm.NewConnection("billing", nil, mt.Client, "billing"))
+		defer mgm.RemoveConnection("billing")
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+
+		err = mgm.Use("billing").TransactionWithCtx(context.Background(), func(session mongo.Session, sc mongo.SessionContext) error {
+			return mgm.Emit(sc, "invoice.paid", bson.M{"total": 10})
+		})
+		util.AssertErrIsNil(t, err)
+
+		emit := mt.GetStartedEvent()
+		require.Equal(t, "outbox", emit.Command.Lookup("insert").StringValue())
+		require.Equal(t, "billing", emit.DatabaseName)
+	})
+}
+
+func TestEmitUnknownClient(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		other, err := mongo.NewClient()
+		util.AssertErrIsNil(t, err)
+		mgm.RegisterConnection(mgm.NewConnection(mgm.DefaultConnectionName, nil, other, "db"))
+
+		session, err := mt.Client.StartSession()
+		util.AssertErrIsNil(t, err)
+		defer session.EndSession(context.Background())
+
+		err = mgm.Emit(mongo.NewSessionContext(context.Background(), session), "invoice.paid", bson.M{"total": 10})
+		require.True(t, errors.Is(err, mgm.ErrUnknownClient))
+		require.Nil(t, mt.GetStartedEvent())
+	})
+}
+
+func TestRelayOnceNoEvents(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+
+		relayed, err := mgm.NewRelay(mgm.NewChannelPublisher(1), &mgm.RelayOptions{MaxAttempts: 3}).RelayOnce(context.Background())
+		util.AssertErrIsNil(t, err)
+		require.False(t, relayed)
+
+		require.Equal(t, int64(3), mt.GetStartedEvent().Command.Lookup("query", "attempts", "$lt").AsInt64())
+	})
+}
@@ -0,0 +1,242 @@
+package mgm
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/uncle-gua/mgm/field"
+	"github.com/uncle-gua/mgm/operator"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrInvalidPageToken is returned when a keyset page token can not be decoded
+// or does not belong to the requested sort fields.
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// Pagination contains the metadata of an offset page.
+type Pagination struct {
+	Total      int64 `json:"total"`
+	Page       int64 `json:"page"`
+	PerPage    int64 `json:"per_page"`
+	TotalPages int64 `json:"total_pages"`
+	HasNext    bool  `json:"has_next"`
+	HasPrev    bool  `json:"has_prev"`
+}
+
+// KeysetPagination contains the metadata of a keyset page.
+type KeysetPagination struct {
+	// Next is the token of the next page, empty if this is the last page.
+	Next    string `json:"next,omitempty"`
+	HasNext bool   `json:"has_next"`
+}
+
+// Paginate finds the documents of the page (starting from 1) matching the filter, sorted
+// by the sort fields (e.g "-created_at"), decodes them to the results and returns the
+// page's metadata. The page and the total count are computed by a single aggregation.
+func (coll *Collection) Paginate(ctx context.Context, filter interface{}, page, perPage int64, results interface{}, sort ...string) (*Pagination, error) {
+	return coll.PaginateAggregate(ctx, page, perPage, results, findStages(filter, sort)...)
+}
+
+// PaginateAggregate runs the aggregation stages, decodes the documents of the page
+// (starting from 1) to the results and returns the page's metadata.
+// The value of `stages` can be Operator|bson.M
+func (coll *Collection) PaginateAggregate(ctx context.Context, page, perPage int64, results interface{}, stages ...interface{}) (*Pagination, error) {
+	if perPage < 1 {
+		return nil, errors.New("items per page must be positive")
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	facet := bson.M{operator.Facet: bson.M{
+		"metadata": bson.A{bson.M{operator.Count: "total"}},
+		"data": bson.A{
+			bson.M{operator.Skip: (page - 1) * perPage},
+			bson.M{operator.Limit: perPage},
+		},
+	}}
+
+	var res struct {
+		Metadata []struct {
+			Total int64 `bson:"total"`
+		} `bson:"metadata"`
+		Data bson.RawValue `bson:"data"`
+	}
+
+	if _, err := coll.forResults(results).SimpleAggregateFirstWithCtx(ctx, &res, append(stages, facet)...); err != nil {
+		return nil, err
+	}
+
+	if err := res.Data.Unmarshal(results); err != nil {
+		return nil, err
+	}
+
+	if err := callToFoundHooksOfResults(ctx, results); err != nil {
+		return nil, err
+	}
+
+	p := &Pagination{Page: page, PerPage: perPage}
+	if len(res.Metadata) != 0 {
+		p.Total = res.Metadata[0].Total
+	}
+	p.TotalPages = (p.Total + perPage - 1) / perPage
+	p.HasNext = page < p.TotalPages
+	p.HasPrev = page > 1
+
+	return p, nil
+}
+
+// KeysetPaginate finds at most limit documents matching the filter that come after
+// the page token, sorted by the sort fields (e.g "-created_at") and `_id`, decodes
+// them to the results and returns the next page's token. Pass an empty token to
+// get the first page. Unlike offset pages, keyset pages are stable when documents
+// are inserted concurrently.
+func (coll *Collection) KeysetPaginate(ctx context.Context, filter interface{}, sort []string, limit int64, token string, results interface{}) (*KeysetPagination, error) {
+	return coll.KeysetPaginateAggregate(ctx, sort, limit, token, results, findStages(filter, nil)...)
+}
+
+// KeysetPaginateAggregate runs the aggregation stages, then returns the keyset page
+// just like KeysetPaginate.
+// The value of `stages` can be Operator|bson.M
+func (coll *Collection) KeysetPaginateAggregate(ctx context.Context, sort []string, limit int64, token string, results interface{}, stages ...interface{}) (*KeysetPagination, error) {
+	if limit < 1 {
+		return nil, errors.New("page limit must be positive")
+	}
+
+	keys := keysetKeys(sort)
+
+	if token != "" {
+		values, err := decodePageToken(token, len(keys))
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, bson.M{operator.Match: keysetFilter(keys, values)})
+	}
+
+	sortDoc := bson.D{}
+	for _, k := range keys {
+		sortDoc = append(sortDoc, bson.E{Key: k.field, Value: k.direction})
+	}
+	stages = append(stages, bson.M{operator.Sort: sortDoc}, bson.M{operator.Limit: limit + 1})
+
+	var docs []bson.Raw
+	if err := coll.forResults(results).SimpleAggregateWithCtx(ctx, &docs, stages...); err != nil {
+		return nil, err
+	}
+
+	p := &KeysetPagination{}
+	if int64(len(docs)) > limit {
+		docs = docs[:limit]
+		p.HasNext = true
+		p.Next = encodePageToken(keys, docs[len(docs)-1])
+	}
+
+	// Decode the raw documents to the results slice.
+	raw, err := bson.Marshal(bson.M{"data": docs})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bson.Raw(raw).Lookup("data").Unmarshal(results); err != nil {
+		return nil, err
+	}
+
+	return p, callToFoundHooksOfResults(ctx, results)
+}
+
+// findStages returns the aggregation stages that are equal to a find query.
+func findStages(filter interface{}, sort []string) []interface{} {
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	stages := []interface{}{bson.M{operator.Match: filter}}
+	if len(sort) != 0 {
+		stages = append(stages, bson.M{operator.Sort: fieldsDoc(sort, -1)})
+	}
+
+	return stages
+}
+
+type keysetKey struct {
+	field     string
+	direction int
+}
+
+// keysetKeys returns the sort keys of a keyset page. The `_id` field is
+// always the last key to make the order unique.
+func keysetKeys(sort []string) []keysetKey {
+	keys := []keysetKey{}
+	direction := 1
+
+	for _, e := range fieldsDoc(sort, -1) {
+		if e.Key == field.ID {
+			continue
+		}
+		direction = e.Value.(int)
+		keys = append(keys, keysetKey{field: e.Key, direction: direction})
+	}
+
+	return append(keys, keysetKey{field: field.ID, direction: direction})
+}
+
+// keysetFilter returns the filter of documents that come after the values
+// in the keys order.
+func keysetFilter(keys []keysetKey, values []bson.RawValue) bson.M {
+	or := bson.A{}
+
+	for i, k := range keys {
+		cond := bson.M{}
+		for j := 0; j < i; j++ {
+			cond[keys[j].field] = values[j]
+		}
+
+		op := operator.Gt
+		if k.direction < 0 {
+			op = operator.Lt
+		}
+		cond[k.field] = bson.M{op: values[i]}
+
+		or = append(or, cond)
+	}
+
+	return bson.M{operator.Or: or}
+}
+
+func encodePageToken(keys []keysetKey, doc bson.Raw) string {
+	values := bson.A{}
+
+	for _, k := range keys {
+		val, err := doc.LookupErr(strings.Split(k.field, ".")...)
+		if err != nil {
+			val = bson.RawValue{Type: bson.TypeNull}
+		}
+		values = append(values, val)
+	}
+
+	// The values are always encodable, because they're read from a document.
+	raw, _ := bson.Marshal(bson.M{"v": values})
+
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodePageToken(token string, keysCount int) ([]bson.RawValue, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || bson.Raw(raw).Validate() != nil {
+		return nil, ErrInvalidPageToken
+	}
+
+	val, err := bson.Raw(raw).LookupErr("v")
+	if err != nil || val.Type != bson.TypeArray {
+		return nil, ErrInvalidPageToken
+	}
+
+	elems, err := val.Array().Values()
+	if err != nil || len(elems) != keysCount {
+		return nil, ErrInvalidPageToken
+	}
+
+	return elems, nil
+}
@@ -0,0 +1,105 @@
+package mgm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uncle-gua/mgm"
+	"github.com/uncle-gua/mgm/internal/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCollection_Paginate(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch, bson.D{
+			{Key: "metadata", Value: bson.A{bson.D{{Key: "total", Value: int32(45)}}}},
+			{Key: "data", Value: bson.A{bson.D{{Key: "name", Value: "Ali"}}, bson.D{{Key: "name", Value: "Reza"}}}},
+		}))
+
+		var docs []Doc
+		p, err := coll.Paginate(context.Background(), bson.M{"age": 24}, 2, 20, &docs, "-age")
+		util.AssertErrIsNil(t, err)
+
+		require.Equal(t, &mgm.Pagination{Total: 45, Page: 2, PerPage: 20, TotalPages: 3, HasNext: true, HasPrev: true}, p)
+		require.Len(t, docs, 2)
+		require.Equal(t, "Reza", docs[1].Name)
+
+		pipeline := mt.GetStartedEvent().Command.Lookup("pipeline").Array()
+		require.Equal(t, int64(24), pipeline.Index(0).Value().Document().Lookup("$match", "age").AsInt64())
+		require.Equal(t, int64(-1), pipeline.Index(1).Value().Document().Lookup("$sort", "age").AsInt64())
+
+		data := pipeline.Index(2).Value().Document().Lookup("$facet", "data").Array()
+		require.Equal(t, int64(20), data.Index(0).Value().Document().Lookup("$skip").AsInt64())
+		require.Equal(t, int64(20), data.Index(1).Value().Document().Lookup("$limit").AsInt64())
+	})
+}
+
+func TestCollection_PaginateEmpty(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch, bson.D{
+			{Key: "metadata", Value: bson.A{}},
+			{Key: "data", Value: bson.A{}},
+		}))
+
+		var docs []Doc
+		p, err := coll.Paginate(context.Background(), nil, 1, 10, &docs)
+		util.AssertErrIsNil(t, err)
+
+		require.Equal(t, &mgm.Pagination{Page: 1, PerPage: 10}, p)
+		require.Len(t, docs, 0)
+	})
+}
+
+func TestCollection_KeysetPaginate(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		ids := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch,
+			bson.D{{Key: "_id", Value: ids[0]}, {Key: "age", Value: 30}},
+			bson.D{{Key: "_id", Value: ids[1]}, {Key: "age", Value: 27}},
+			bson.D{{Key: "_id", Value: ids[2]}, {Key: "age", Value: 24}},
+		))
+
+		ctx := context.Background()
+		var docs []Doc
+		p, err := coll.KeysetPaginate(ctx, bson.M{}, []string{"-age"}, 2, "", &docs)
+		util.AssertErrIsNil(t, err)
+
+		require.True(t, p.HasNext)
+		require.NotEmpty(t, p.Next)
+		require.Len(t, docs, 2)
+		require.Equal(t, ids[1], docs[1].ID)
+
+		pipeline := mt.GetStartedEvent().Command.Lookup("pipeline").Array()
+		require.Equal(t, []string{"age", "_id"}, keysOf(pipeline.Index(1).Value().Document().Lookup("$sort").Document()))
+		require.Equal(t, int64(3), pipeline.Index(2).Value().Document().Lookup("$limit").AsInt64())
+
+		// Get the next page using the token:
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch,
+			bson.D{{Key: "_id", Value: ids[2]}, {Key: "age", Value: 24}},
+		))
+
+		p, err = coll.KeysetPaginate(ctx, bson.M{}, []string{"-age"}, 2, p.Next, &docs)
+		util.AssertErrIsNil(t, err)
+		require.False(t, p.HasNext)
+		require.Empty(t, p.Next)
+		require.Len(t, docs, 1)
+
+		pipeline = mt.GetStartedEvent().Command.Lookup("pipeline").Array()
+		or := pipeline.Index(1).Value().Document().Lookup("$match", "$or").Array()
+		require.Equal(t, int64(27), or.Index(0).Value().Document().Lookup("age", "$lt").AsInt64())
+		require.Equal(t, int64(27), or.Index(1).Value().Document().Lookup("age").AsInt64())
+		require.Equal(t, ids[1], or.Index(1).Value().Document().Lookup("_id", "$lt").ObjectID())
+	})
+}
+
+func TestCollection_KeysetPaginateInvalidToken(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		var docs []Doc
+		_, err := coll.KeysetPaginate(context.Background(), bson.M{}, []string{"age"}, 2, "invalid", &docs)
+
+		require.Equal(t, mgm.ErrInvalidPageToken, err)
+	})
+}
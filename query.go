@@ -0,0 +1,277 @@
+package mgm
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/uncle-gua/mgm/builder"
+	"github.com/uncle-gua/mgm/field"
+	"github.com/uncle-gua/mgm/operator"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Query is a fluent query builder on top of a collection. Its conditions
+// are combined using `$and`.
+type Query struct {
+	coll       *Collection
+	conds      []interface{}
+	sort       bson.D
+	projection bson.D
+	limit      *int64
+	skip       *int64
+	with       []string
+}
+
+// Query returns a new query on the collection.
+func (coll *Collection) Query() *Query {
+	return &Query{coll: coll}
+}
+
+// Cond returns a `{field: {op: val}}` condition to be used in the
+// query's `Or`, `Nor` and `Match` methods.
+func Cond(field, op string, val interface{}) bson.M {
+	return bson.M{field: bson.M{op: val}}
+}
+
+// Where adds a `{field: {op: val}}` condition to the query
+// e.g Where("pages", operator.Gt, 100).
+func (q *Query) Where(field, op string, val interface{}) *Query {
+	return q.Match(Cond(field, op, val))
+}
+
+// In adds a `{field: {$in: values}}` condition to the query.
+func (q *Query) In(field string, values ...interface{}) *Query {
+	return q.Where(field, operator.In, values)
+}
+
+// Nin adds a `{field: {$nin: values}}` condition to the query.
+func (q *Query) Nin(field string, values ...interface{}) *Query {
+	return q.Where(field, operator.Nin, values)
+}
+
+// Or adds a condition that matches if any of the provided conditions matches.
+// The value of conditions can be *Query|Operator|bson.M|bson.D
+func (q *Query) Or(conds ...interface{}) *Query {
+	return q.Match(bson.M{operator.Or: toConds(conds)})
+}
+
+// Nor adds a condition that matches if none of the provided conditions matches.
+// The value of conditions can be *Query|Operator|bson.M|bson.D
+func (q *Query) Nor(conds ...interface{}) *Query {
+	return q.Match(bson.M{operator.Nor: toConds(conds)})
+}
+
+// Match adds raw conditions to the query.
+// The value of conditions can be *Query|Operator|bson.M|bson.D
+func (q *Query) Match(conds ...interface{}) *Query {
+	q.conds = append(q.conds, toConds(conds)...)
+	return q
+}
+
+// Sort sets the query's sort fields. Prefix a field with "-" to sort it descending
+// e.g Sort("-created_at", "name").
+func (q *Query) Sort(fields ...string) *Query {
+	q.sort = fieldsDoc(fields, -1)
+	return q
+}
+
+// Project sets the query's projection fields. Prefix a field with "-" to exclude it
+// e.g Project("name", "pages") or Project("-content").
+func (q *Query) Project(fields ...string) *Query {
+	q.projection = fieldsDoc(fields, 0)
+	return q
+}
+
+// Limit sets the maximum number of documents the query returns.
+func (q *Query) Limit(n int64) *Query {
+	q.limit = &n
+	return q
+}
+
+// Skip sets the number of documents the query skips.
+func (q *Query) Skip(n int64) *Query {
+	q.skip = &n
+	return q
+}
+
+// With loads the relations of the query results, e.g With("Author", "Reviews").
+// See LoadRelations for declaring relations.
+func (q *Query) With(relations ...string) *Query {
+	q.with = append(q.with, relations...)
+	return q
+}
+
+// Filter returns the query's filter.
+func (q *Query) Filter() bson.M {
+	switch len(q.conds) {
+	case 0:
+		return bson.M{}
+	case 1:
+		if m, ok := q.conds[0].(bson.M); ok {
+			return m
+		}
+	}
+
+	return bson.M{operator.And: bson.A(q.conds)}
+}
+
+// FindOptions returns the query's find options.
+func (q *Query) FindOptions() *options.FindOptions {
+	opts := options.Find()
+
+	if q.sort != nil {
+		opts.SetSort(q.sort)
+	}
+	if q.projection != nil {
+		opts.SetProjection(q.projection)
+	}
+	if q.limit != nil {
+		opts.SetLimit(*q.limit)
+	}
+	if q.skip != nil {
+		opts.SetSkip(*q.skip)
+	}
+
+	return opts
+}
+
+// All finds, decodes and returns the query results.
+func (q *Query) All(ctx context.Context, results interface{}) error {
+	if err := q.coll.SimpleFindWithCtx(ctx, results, q.Filter(), q.FindOptions()); err != nil {
+		return err
+	}
+
+	return LoadRelations(ctx, results, q.with...)
+}
+
+// First decodes the first document of the query results to the model.
+func (q *Query) First(ctx context.Context, model Model) error {
+	opts := options.FindOne()
+
+	if q.sort != nil {
+		opts.SetSort(q.sort)
+	}
+	if q.projection != nil {
+		opts.SetProjection(q.projection)
+	}
+	if q.skip != nil {
+		opts.SetSkip(*q.skip)
+	}
+
+	if err := first(ctx, q.coll, q.Filter(), model, opts); err != nil {
+		return err
+	}
+
+	return LoadRelations(ctx, model, q.with...)
+}
+
+// Count returns the number of documents matching the query.
+func (q *Query) Count(ctx context.Context) (int64, error) {
+	opts := options.Count()
+
+	if q.limit != nil {
+		opts.SetLimit(*q.limit)
+	}
+	if q.skip != nil {
+		opts.SetSkip(*q.skip)
+	}
+
+	return q.coll.CountDocumentsWithCtx(ctx, q.Filter(), opts)
+}
+
+// Exists returns true if any document matches the query.
+func (q *Query) Exists(ctx context.Context) (bool, error) {
+	opts := options.Count().SetLimit(1)
+
+	if q.skip != nil {
+		opts.SetSkip(*q.skip)
+	}
+
+	count, err := q.coll.CountDocumentsWithCtx(ctx, q.Filter(), opts)
+	return count > 0, err
+}
+
+// Paginate decodes the query's page (starting from 1) to the results and returns
+// the page's metadata. The query's limit and skip are ignored.
+func (q *Query) Paginate(ctx context.Context, page, perPage int64, results interface{}) (*Pagination, error) {
+	stages := []interface{}{bson.M{operator.Match: q.Filter()}}
+
+	if q.sort != nil {
+		stages = append(stages, bson.M{operator.Sort: q.sort})
+	}
+	if q.projection != nil {
+		stages = append(stages, bson.M{operator.Project: q.projection})
+	}
+
+	p, err := q.coll.PaginateAggregate(ctx, page, perPage, results, stages...)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, LoadRelations(ctx, results, q.with...)
+}
+
+// Cursor returns a cursor over the query results.
+func (q *Query) Cursor(ctx context.Context) (*mongo.Cursor, error) {
+	return q.coll.FindWithCtx(ctx, q.coll.scopeFilter(q.Filter()), q.FindOptions())
+}
+
+// Delete deletes the documents matching the query. If the collection's
+// model supports soft delete, the documents are soft deleted.
+// Note: this method does not call the models' hooks, and it returns ErrNotRecorded
+// if the collection's model is auditable or revisioned.
+func (q *Query) Delete(ctx context.Context) (*mongo.DeleteResult, error) {
+	if q.coll.recorded {
+		return nil, ErrNotRecorded
+	}
+
+	filter := q.coll.scopeFilter(q.Filter())
+
+	if !q.coll.softDelete {
+		return q.coll.DeleteManyCtx(ctx, filter)
+	}
+
+	res, err := updateMany(ctx, q.coll, filter, bson.M{operator.Set: bson.M{field.DeletedAt: time.Now().UTC()}}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mongo.DeleteResult{DeletedCount: res.ModifiedCount}, nil
+}
+
+// toConds converts queries and operators to filter conditions.
+func toConds(conds []interface{}) []interface{} {
+	res := make([]interface{}, len(conds))
+
+	for i, cond := range conds {
+		switch c := cond.(type) {
+		case *Query:
+			res[i] = c.Filter()
+		case builder.Operator:
+			res[i] = builder.S(c)
+		default:
+			res[i] = c
+		}
+	}
+
+	return res
+}
+
+// fieldsDoc converts fields to an ordered document with value 1, or the
+// negative value for fields prefixed by "-".
+func fieldsDoc(fields []string, negative int) bson.D {
+	doc := bson.D{}
+
+	for _, f := range fields {
+		if strings.HasPrefix(f, "-") {
+			doc = append(doc, bson.E{Key: f[1:], Value: negative})
+		} else {
+			doc = append(doc, bson.E{Key: f, Value: 1})
+		}
+	}
+
+	return doc
+}
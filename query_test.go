@@ -0,0 +1,126 @@
+package mgm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uncle-gua/mgm"
+	"github.com/uncle-gua/mgm/builder"
+	"github.com/uncle-gua/mgm/internal/util"
+	"github.com/uncle-gua/mgm/operator"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestQuery_Filter(t *testing.T) {
+	setupDefConnection()
+
+	q := mgm.Coll(&Doc{}).Query().
+		Where("age", operator.Gt, 20).
+		In("name", "Ali", "Reza").
+		Or(mgm.Cond("age", operator.Lt, 30), builder.New("name", "Omid"))
+
+	require.Equal(t, bson.M{operator.And: bson.A{
+		bson.M{"age": bson.M{operator.Gt: 20}},
+		bson.M{"name": bson.M{operator.In: []interface{}{"Ali", "Reza"}}},
+		bson.M{operator.Or: []interface{}{
+			bson.M{"age": bson.M{operator.Lt: 30}},
+			bson.M{"name": "Omid"},
+		}},
+	}}, q.Filter())
+}
+
+func TestQuery_FilterWithSingleCondition(t *testing.T) {
+	setupDefConnection()
+
+	require.Equal(t, bson.M{}, mgm.Coll(&Doc{}).Query().Filter())
+	require.Equal(t, bson.M{"age": bson.M{operator.Gte: 20}},
+		mgm.Coll(&Doc{}).Query().Where("age", operator.Gte, 20).Filter())
+}
+
+func TestQuery_All(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch,
+			bson.D{{Key: "name", Value: "Ali"}}))
+
+		var docs []Doc
+		err := coll.Query().
+			Where("age", operator.Gt, 20).
+			Sort("-created_at", "name").
+			Project("name", "-_id").
+			Limit(20).
+			Skip(40).
+			All(context.Background(), &docs)
+		util.AssertErrIsNil(t, err)
+		require.Len(t, docs, 1)
+
+		cmd := mt.GetStartedEvent().Command
+		require.Equal(t, int64(20), cmd.Lookup("filter", "age", "$gt").AsInt64())
+		require.Equal(t, []string{"created_at", "name"}, keysOf(cmd.Lookup("sort").Document()))
+		require.Equal(t, int64(-1), cmd.Lookup("sort", "created_at").AsInt64())
+		require.Equal(t, int64(0), cmd.Lookup("projection", "_id").AsInt64())
+		require.Equal(t, int64(20), cmd.Lookup("limit").AsInt64())
+		require.Equal(t, int64(40), cmd.Lookup("skip").AsInt64())
+	})
+}
+
+func TestQuery_First(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch,
+			bson.D{{Key: "name", Value: "Ali"}}))
+
+		doc := &Doc{}
+		util.AssertErrIsNil(t, coll.Query().Where("name", operator.Eq, "Ali").Sort("-age").First(context.Background(), doc))
+		require.Equal(t, "Ali", doc.Name)
+
+		cmd := mt.GetStartedEvent().Command
+		require.Equal(t, int64(1), cmd.Lookup("limit").AsInt64())
+		require.Equal(t, int64(-1), cmd.Lookup("sort", "age").AsInt64())
+	})
+}
+
+func TestQuery_Exists(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch,
+			bson.D{{Key: "n", Value: 1}}))
+
+		exists, err := coll.Query().Where("age", operator.Gt, 20).Exists(context.Background())
+		util.AssertErrIsNil(t, err)
+		require.True(t, exists)
+
+		pipeline := mt.GetStartedEvent().Command.Lookup("pipeline").Array()
+		require.Equal(t, int64(1), pipeline.Index(1).Value().Document().Lookup("$limit").AsInt64())
+	})
+}
+
+func TestQuery_DeleteSoftDeletesModels(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(
+			bson.E{Key: "n", Value: 2},
+			bson.E{Key: "nModified", Value: 2},
+		))
+
+		res, err := softColl(coll).Query().Where("title", operator.Eq, "old").Delete(context.Background())
+		util.AssertErrIsNil(t, err)
+		require.Equal(t, int64(2), res.DeletedCount)
+
+		evt := mt.GetStartedEvent()
+		require.Equal(t, "update", evt.CommandName)
+
+		upd := evt.Command.Lookup("updates").Array().Index(0).Value().Document()
+		require.True(t, upd.Lookup("multi").Boolean())
+		require.Equal(t, bson.TypeDateTime, upd.Lookup("u", "$set", "deleted_at").Type)
+	})
+}
+
+func TestQuery_Delete(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 3}))
+
+		res, err := coll.Query().Where("age", operator.Lt, 20).Delete(context.Background())
+		util.AssertErrIsNil(t, err)
+		require.Equal(t, int64(3), res.DeletedCount)
+		require.Equal(t, "delete", mt.GetStartedEvent().CommandName)
+	})
+}
@@ -0,0 +1,354 @@
+package mgm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/jinzhu/inflection"
+	"github.com/uncle-gua/mgm/field"
+	"github.com/uncle-gua/mgm/internal/util"
+	"github.com/uncle-gua/mgm/operator"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+)
+
+// ErrUnknownRelation is returned when loading a relation that a model does not declare.
+var ErrUnknownRelation = errors.New("unknown relation")
+
+// relationKind is the kind of a relation, as declared by the `mgm` tag of its field.
+type relationKind string
+
+const (
+	// belongsTo relation: the model's fk field contains the related model's ID.
+	belongsTo relationKind = "belongsTo"
+	// hasOne relation: the related model's fk field contains the model's ID.
+	hasOne relationKind = "hasOne"
+	// hasMany relation: the related models' fk field contains the model's ID.
+	hasMany relationKind = "hasMany"
+	// manyToMany relation: the model's fk field is an array of the related models' IDs.
+	manyToMany relationKind = "manyToMany"
+)
+
+var relationKinds = []relationKind{belongsTo, hasOne, hasMany, manyToMany}
+
+var modelType = reflect.TypeOf((*Model)(nil)).Elem()
+
+// relation is a relation field of a model.
+type relation struct {
+	name  string
+	kind  relationKind
+	index []int
+	// related is the related model's struct type.
+	related reflect.Type
+	// fk is the bson path of the foreign key field.
+	fk string
+}
+
+var relationsCache sync.Map
+
+// modelRelations returns the relations a model's struct type declares, by their field name.
+func modelRelations(t reflect.Type) (map[string]relation, error) {
+	if rels, ok := relationsCache.Load(t); ok {
+		return rels.(map[string]relation), nil
+	}
+
+	rels := map[string]relation{}
+	if err := structRelations(t, t, nil, rels); err != nil {
+		return nil, err
+	}
+
+	relationsCache.Store(t, rels)
+	return rels, nil
+}
+
+func structRelations(model, t reflect.Type, index []int, rels map[string]relation) error {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		fieldIndex := append(append([]int{}, index...), i)
+
+		if tags, err := bsoncodec.DefaultStructTagParser(sf); err == nil && tags.Inline && sf.Type.Kind() == reflect.Struct {
+			if err := structRelations(model, sf.Type, fieldIndex, rels); err != nil {
+				return err
+			}
+			continue
+		}
+
+		tag := parseTagOptions(sf.Tag.Get("mgm"))
+
+		var kind relationKind
+		for _, k := range relationKinds {
+			if tag.has(string(k)) {
+				kind = k
+			}
+		}
+		if kind == "" {
+			continue
+		}
+
+		rel := relation{name: sf.Name, kind: kind, index: fieldIndex, fk: tag["fk"]}
+
+		related := sf.Type
+		if kind == hasMany || kind == manyToMany {
+			if related.Kind() != reflect.Slice {
+				return fmt.Errorf("%s relation %s must be a slice", kind, sf.Name)
+			}
+			related = related.Elem()
+		}
+		rel.related = indirectType(related)
+
+		if rel.related.Kind() != reflect.Struct || !reflect.PtrTo(rel.related).Implements(modelType) {
+			return fmt.Errorf("relation %s must be a model", sf.Name)
+		}
+
+		if rel.fk == "" {
+			rel.fk = defaultForeignKey(model, rel)
+		}
+
+		rels[rel.name] = rel
+	}
+
+	return nil
+}
+
+// defaultForeignKey returns the foreign key of a relation that does not specify it,
+// e.g "author_id" for `Author *Author` belongsTo relation of a book, "book_id"
+// for `Reviews []*Review` hasMany relation of a book and "tag_ids" for `Tags []*Tag`
+// manyToMany relation.
+func defaultForeignKey(model reflect.Type, rel relation) string {
+	switch rel.kind {
+	case belongsTo:
+		return util.ToSnakeCase(rel.name) + "_id"
+	case manyToMany:
+		return util.ToSnakeCase(inflection.Singular(rel.name)) + "_ids"
+	}
+
+	return util.ToSnakeCase(model.Name()) + "_id"
+}
+
+// LoadRelations loads the relations of the models using batched `$in` queries and
+// fills their relation fields. The models can be a model or a slice of models
+// (e.g []*Book), nil models are skipped. Load nested relations using a dotted name
+// (e.g "Author.Publisher").
+//
+// The relations are declared using the `mgm` tag of the relation fields:
+//   - belongsTo: the model's fk field contains the related model's ID,
+//     e.g `Author *Author bson:"-" mgm:"belongsTo,fk=author_id"`.
+//   - hasOne, hasMany: the related models' fk field contains the model's ID,
+//     e.g `Reviews []*Review bson:"-" mgm:"hasMany,fk=book_id"`.
+//   - manyToMany: the model's fk field is an array of the related models' IDs,
+//     e.g `Tags []*Tag bson:"-" mgm:"manyToMany,fk=tag_ids"`.
+func LoadRelations(ctx context.Context, models interface{}, relations ...string) error {
+	parents := modelValues(reflect.ValueOf(models))
+	if len(parents) == 0 || len(relations) == 0 {
+		return nil
+	}
+
+	rels, err := modelRelations(parents[0].Type().Elem())
+	if err != nil {
+		return err
+	}
+
+	// Group the nested relations by their first relation.
+	var names []string
+	nested := map[string][]string{}
+	for _, name := range relations {
+		first, rest := name, ""
+		if i := strings.Index(name, "."); i != -1 {
+			first, rest = name[:i], name[i+1:]
+		}
+
+		if _, ok := nested[first]; !ok {
+			names = append(names, first)
+			nested[first] = nil
+		}
+		if rest != "" {
+			nested[first] = append(nested[first], rest)
+		}
+	}
+
+	for _, name := range names {
+		rel, ok := rels[name]
+		if !ok {
+			return fmt.Errorf("%w %s of %s", ErrUnknownRelation, name, parents[0].Type().Elem().Name())
+		}
+
+		loaded, err := loadRelation(ctx, parents, rel)
+		if err != nil {
+			return err
+		}
+
+		if len(nested[name]) != 0 && len(loaded) != 0 {
+			if err := LoadRelations(ctx, loaded, nested[name]...); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// loadRelation loads the relation of the parents and returns the loaded models.
+func loadRelation(ctx context.Context, parents []reflect.Value, rel relation) ([]Model, error) {
+	parentDocs := make([]bson.Raw, len(parents))
+	for i, p := range parents {
+		doc, err := bson.Marshal(p.Interface())
+		if err != nil {
+			return nil, err
+		}
+		parentDocs[i] = doc
+	}
+
+	// The parents' keys that reference the related models, and the related models' key.
+	parentKey, relatedKey := rel.fk, field.ID
+	if rel.kind == hasOne || rel.kind == hasMany {
+		parentKey, relatedKey = field.ID, rel.fk
+	}
+
+	parentKeys := make([][]bson.RawValue, len(parents))
+	values := bson.A{}
+	for i, doc := range parentDocs {
+		keys := lookupKeys(doc, parentKey, rel.kind == manyToMany)
+		parentKeys[i] = keys
+		for _, k := range keys {
+			values = append(values, k)
+		}
+	}
+
+	related, err := findRelated(ctx, rel, relatedKey, values)
+	if err != nil {
+		return nil, err
+	}
+
+	// Index the related models by their key.
+	byKey := map[string][]reflect.Value{}
+	var loaded []Model
+	for _, r := range related {
+		doc, err := bson.Marshal(r.Interface())
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range lookupKeys(doc, relatedKey, false) {
+			byKey[rawKey(k)] = append(byKey[rawKey(k)], r)
+		}
+		loaded = append(loaded, r.Interface().(Model))
+	}
+
+	for i, p := range parents {
+		var matches []reflect.Value
+		for _, k := range parentKeys[i] {
+			matches = append(matches, byKey[rawKey(k)]...)
+		}
+
+		setRelation(p.Elem().FieldByIndex(rel.index), rel, matches)
+	}
+
+	return loaded, nil
+}
+
+// findRelated finds the related models whose key is one of the values.
+func findRelated(ctx context.Context, rel relation, key string, values bson.A) ([]reflect.Value, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	results := reflect.New(reflect.SliceOf(reflect.PtrTo(rel.related)))
+	coll := Coll(reflect.New(rel.related).Interface().(Model))
+
+	if err := coll.SimpleFindWithCtx(ctx, results.Interface(), bson.M{key: bson.M{operator.In: values}}); err != nil {
+		return nil, err
+	}
+
+	related := make([]reflect.Value, results.Elem().Len())
+	for i := range related {
+		related[i] = results.Elem().Index(i)
+	}
+
+	return related, nil
+}
+
+// setRelation sets the relation field to the related models.
+func setRelation(f reflect.Value, rel relation, related []reflect.Value) {
+	if rel.kind == belongsTo || rel.kind == hasOne {
+		if len(related) == 0 {
+			f.Set(reflect.Zero(f.Type()))
+		} else if f.Kind() == reflect.Ptr {
+			f.Set(related[0])
+		} else {
+			f.Set(related[0].Elem())
+		}
+		return
+	}
+
+	s := reflect.MakeSlice(f.Type(), 0, len(related))
+	for _, r := range related {
+		if f.Type().Elem().Kind() == reflect.Ptr {
+			s = reflect.Append(s, r)
+		} else {
+			s = reflect.Append(s, r.Elem())
+		}
+	}
+	f.Set(s)
+}
+
+// modelValues returns the model pointers of a model or a slice of models.
+func modelValues(v reflect.Value) []reflect.Value {
+	if v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Slice {
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Slice {
+		if v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.Struct {
+			return []reflect.Value{v}
+		}
+		return nil
+	}
+
+	values := make([]reflect.Value, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		elem := v.Index(i)
+		if elem.Kind() == reflect.Interface {
+			elem = elem.Elem()
+		}
+		// Skip the nil interfaces and the values that can't be loaded.
+		if !elem.IsValid() || elem.Kind() != reflect.Ptr && !elem.CanAddr() {
+			continue
+		}
+		if elem.Kind() != reflect.Ptr {
+			elem = elem.Addr()
+		}
+		if !elem.IsNil() {
+			values = append(values, elem)
+		}
+	}
+
+	return values
+}
+
+// lookupKeys returns the values of the key in the document. Array values
+// are flattened when many is true.
+func lookupKeys(doc bson.Raw, key string, many bool) []bson.RawValue {
+	val, err := doc.LookupErr(strings.Split(key, ".")...)
+	if err != nil || val.Type == bson.TypeNull {
+		return nil
+	}
+
+	if many && val.Type == bson.TypeArray {
+		values, _ := val.Array().Values()
+		return values
+	}
+
+	return []bson.RawValue{val}
+}
+
+// rawKey returns a map key of the raw value.
+func rawKey(v bson.RawValue) string {
+	return string(rune(v.Type)) + string(v.Value)
+}
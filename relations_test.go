@@ -0,0 +1,128 @@
+package mgm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uncle-gua/mgm"
+	"github.com/uncle-gua/mgm/internal/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+type Writer struct {
+	mgm.DefaultModel `bson:",inline"`
+
+	Name   string   `bson:"name"`
+	Novels []*Novel `bson:"-" mgm:"hasMany"`
+}
+
+type Novel struct {
+	mgm.DefaultModel `bson:",inline"`
+
+	Title    string               `bson:"title"`
+	WriterID primitive.ObjectID   `bson:"writer_id"`
+	GenreIDs []primitive.ObjectID `bson:"genre_ids"`
+
+	Writer *Writer `bson:"-" mgm:"belongsTo"`
+	Genres []Genre `bson:"-" mgm:"manyToMany,fk=genre_ids"`
+}
+
+type Genre struct {
+	mgm.DefaultModel `bson:",inline"`
+
+	Name string `bson:"name"`
+}
+
+func TestQueryWithRelations(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		w1, w2 := primitive.NewObjectID(), primitive.NewObjectID()
+		g1, g2 := primitive.NewObjectID(), primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.novels", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "title", Value: "a"}, {Key: "writer_id", Value: w1}, {Key: "genre_ids", Value: bson.A{g1, g2}}},
+				bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "title", Value: "b"}, {Key: "writer_id", Value: w2}, {Key: "genre_ids", Value: bson.A{g2}}},
+				bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "title", Value: "c"}, {Key: "writer_id", Value: w1}},
+			),
+			mtest.CreateCursorResponse(0, "db.writers", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: w1}, {Key: "name", Value: "Ali"}},
+				bson.D{{Key: "_id", Value: w2}, {Key: "name", Value: "Reza"}},
+			),
+			mtest.CreateCursorResponse(0, "db.genres", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: g1}, {Key: "name", Value: "drama"}},
+				bson.D{{Key: "_id", Value: g2}, {Key: "name", Value: "poetry"}},
+			),
+		)
+
+		var novels []*Novel
+		util.AssertErrIsNil(t, mgm.Coll(&Novel{}).Query().With("Writer", "Genres").All(context.Background(), &novels))
+
+		require.Len(t, novels, 3)
+		require.Equal(t, "Ali", novels[0].Writer.Name)
+		require.Equal(t, "Reza", novels[1].Writer.Name)
+		require.Same(t, novels[0].Writer, novels[2].Writer)
+
+		require.Equal(t, []string{"drama", "poetry"}, []string{novels[0].Genres[0].Name, novels[0].Genres[1].Name})
+		require.Len(t, novels[1].Genres, 1)
+		require.Empty(t, novels[2].Genres)
+
+		require.Equal(t, "novels", mt.GetStartedEvent().Command.Lookup("find").StringValue())
+
+		writers := mt.GetStartedEvent().Command
+		require.Equal(t, "writers", writers.Lookup("find").StringValue())
+		ids, err := writers.Lookup("filter", "_id", "$in").Array().Values()
+		util.AssertErrIsNil(t, err)
+		require.Len(t, ids, 3)
+
+		require.Equal(t, "genres", mt.GetStartedEvent().Command.Lookup("find").StringValue())
+	})
+}
+
+func TestLoadNestedRelations(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		writer := &Writer{Name: "Ali"}
+		writer.SetID(primitive.NewObjectID())
+		g1 := primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.novels", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "writer_id", Value: writer.ID}, {Key: "genre_ids", Value: bson.A{g1}}},
+			),
+			mtest.CreateCursorResponse(0, "db.genres", mtest.FirstBatch, bson.D{{Key: "_id", Value: g1}, {Key: "name", Value: "drama"}}),
+		)
+
+		util.AssertErrIsNil(t, mgm.LoadRelations(context.Background(), writer, "Novels.Genres"))
+
+		require.Len(t, writer.Novels, 1)
+		require.Equal(t, "drama", writer.Novels[0].Genres[0].Name)
+
+		novels := mt.GetStartedEvent().Command
+		require.Equal(t, writer.ID, novels.Lookup("filter", "writer_id", "$in").Array().Index(0).Value().ObjectID())
+	})
+}
+
+func TestLoadRelationsSkipsNilModels(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		writer := &Writer{Name: "Ali"}
+		writer.SetID(primitive.NewObjectID())
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.novels", mtest.FirstBatch,
+			bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "writer_id", Value: writer.ID}},
+		))
+
+		models := []mgm.Model{nil, writer, (*Writer)(nil)}
+		util.AssertErrIsNil(t, mgm.LoadRelations(context.Background(), models, "Novels"))
+		require.Len(t, writer.Novels, 1)
+
+		util.AssertErrIsNil(t, mgm.LoadRelations(context.Background(), []mgm.Model{nil}, "Novels"))
+	})
+}
+
+func TestLoadUnknownRelation(t *testing.T) {
+	err := mgm.LoadRelations(context.Background(), &Writer{}, "Publisher")
+	require.True(t, errors.Is(err, mgm.ErrUnknownRelation))
+}
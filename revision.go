@@ -0,0 +1,318 @@
+package mgm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/uncle-gua/mgm/field"
+	"github.com/uncle-gua/mgm/operator"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrNotRevisioned is returned when calling the revisions methods of a model
+// that doesn't implement the Revisioned interface.
+var ErrNotRevisioned = errors.New("model is not revisioned")
+
+// RevisionPolicy is the retention policy of a model's revisions.
+type RevisionPolicy struct {
+	// KeepLast is the number of revisions that are kept for each document.
+	// Zero keeps all of them.
+	KeepLast int
+	// TTL is the time that the revisions are kept after their document is revised.
+	// Zero keeps them forever. Revisions expire using a TTL index, which is
+	// created by EnsureIndexes and SyncIndexes.
+	TTL time.Duration
+}
+
+// Revision is a document of a model as it was before being updated or deleted.
+type Revision struct {
+	IDField `bson:",inline"`
+
+	DocumentID interface{} `json:"document_id" bson:"document_id"`
+	// Revision is the number of the revision, starting from 1 for each document.
+	Revision int64 `json:"revision" bson:"revision"`
+	// Op is the operation that revised the document, update or delete.
+	Op AuditOp `json:"op" bson:"op"`
+	// Document is the whole document before the operation.
+	Document bson.Raw `json:"document" bson:"document"`
+	// RevisedAt is the time of the operation, the document was
+	// the revision's document until then.
+	RevisedAt time.Time `json:"revised_at" bson:"revised_at"`
+}
+
+// Decode decodes the revision's document to the model.
+func (r *Revision) Decode(model Model) error {
+	return bson.Unmarshal(r.Document, model)
+}
+
+// Revisions returns the revisions of the model, from the oldest to the newest.
+func Revisions(ctx context.Context, model Model) ([]*Revision, error) {
+	if _, ok := model.(Revisioned); !ok {
+		return nil, ErrNotRevisioned
+	}
+
+	coll := Coll(model)
+	revisions := make([]*Revision, 0)
+
+	filter := bson.M{"document_id": model.GetID()}
+	opts := options.Find().SetSort(bson.M{"revision": 1})
+
+	if err := coll.revisionCollection(ctx).SimpleFindWithCtx(ctx, &revisions, filter, opts); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// RevertTo reverts the model to the revision with the given number, then replaces its
+// document with it (or inserts it, if the document is deleted). The model's updating,
+// saving, updated and saved hooks are called, and the replaced document becomes a
+// new revision. The model keeps its version, so reverting a stale versioned model
+// fails with a version conflict. The model is unchanged if the revert fails.
+func RevertTo(ctx context.Context, model Model, rev int64) error {
+	if _, ok := model.(Revisioned); !ok {
+		return ErrNotRevisioned
+	}
+
+	coll := Coll(model)
+	revision := &Revision{}
+
+	filter := bson.M{"document_id": model.GetID(), "revision": rev}
+	if err := coll.revisionCollection(ctx).FirstWithCtx(ctx, filter, revision); err != nil {
+		return err
+	}
+
+	id, err := coll.findID(ctx, model, bson.M{field.ID: model.GetID()})
+	if err != nil {
+		return err
+	}
+
+	versioned, isVersioned := model.(Versioned)
+	var version int64
+	if isVersioned {
+		version = versioned.GetVersion()
+	}
+
+	// Reset the model, so the fields that the revision doesn't have are removed.
+	v := reflect.ValueOf(model).Elem()
+	orig := reflect.New(v.Type()).Elem()
+	orig.Set(v)
+	v.Set(reflect.Zero(v.Type()))
+
+	// Just insert the revision if its document is deleted.
+	var opts []*options.ReplaceOptions
+	if id == nil {
+		opts = append(opts, options.Replace().SetUpsert(true))
+	}
+
+	err = revision.Decode(model)
+	if err == nil {
+		if isVersioned {
+			versioned.SetVersion(version)
+		}
+
+		err = replace(ctx, coll, model, opts...)
+	}
+
+	if err != nil {
+		v.Set(orig)
+	}
+
+	// The document is inserted since it's checked, so the model is stale.
+	if isVersioned && mongo.IsDuplicateKeyError(err) {
+		return &VersionConflictError{ID: model.GetID(), Version: version}
+	}
+
+	return err
+}
+
+// AsOf finds the document with the given id as it was at the given time, and decodes
+// it to the model. It returns mongo.ErrNoDocuments if the document didn't exist at
+// that time: it's created after it (using its `created_at` field), or it's deleted
+// before it. The model's finding and found hooks are called.
+func (coll *Collection) AsOf(ctx context.Context, id interface{}, t time.Time, model Model) error {
+	if _, ok := model.(Revisioned); !ok {
+		return ErrNotRevisioned
+	}
+
+	id, err := model.PrepareID(id)
+	if err != nil {
+		return err
+	}
+
+	if err := callToFindingHooks(ctx, model); err != nil {
+		return err
+	}
+
+	doc, err := coll.documentAsOf(ctx, id, t)
+	if err != nil {
+		return err
+	}
+
+	if createdAt, ok := doc.Lookup(field.CreatedAt).TimeOK(); ok && createdAt.After(t) {
+		return mongo.ErrNoDocuments
+	}
+
+	if err := bson.Unmarshal(doc, model); err != nil {
+		return err
+	}
+
+	return callToFoundHooks(ctx, model)
+}
+
+// documentAsOf returns the document with the given id as it was at the given time:
+// the first revision that is revised after it, or the current document.
+func (coll *Collection) documentAsOf(ctx context.Context, id interface{}, t time.Time) (bson.Raw, error) {
+	revision := &Revision{}
+
+	filter := bson.M{"document_id": id, "revised_at": bson.M{operator.Gt: t}}
+	opts := options.FindOne().SetSort(bson.D{{Key: "revised_at", Value: 1}, {Key: "revision", Value: 1}})
+
+	err := coll.revisionCollection(ctx).FirstWithCtx(ctx, filter, revision, opts)
+	if err == nil {
+		return revision.Document, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	var doc bson.Raw
+	op := &OpInfo{Op: OpFirst, Filter: coll.scopeFilter(bson.M{field.ID: id}), Options: []*options.FindOneOptions{}}
+
+	err = coll.intercept(ctx, op, func(ctx context.Context, op *OpInfo) (err error) {
+		opts, err := opOptions[*options.FindOneOptions](op)
+		if err != nil {
+			return err
+		}
+
+		doc, err = coll.collection(ctx).FindOne(ctx, op.Filter, opts...).DecodeBytes()
+		return err
+	})
+
+	return doc, err
+}
+
+// revisionCollection returns the collection of the collection's revisions.
+func (coll *Collection) revisionCollection(ctx context.Context) *Collection {
+	return coll.relatedCollection(ctx, coll.collection(ctx).Name()+"_revisions")
+}
+
+// recordChange writes the audit record and the revision of a model's change. The
+// stored document is the document before the change, nil for created models.
+// The new document is the model, unless it's deleted (soft deleted models keep
+// their document). Changes of documents that don't exist are not recorded.
+func recordChange(ctx context.Context, coll *Collection, model Model, op AuditOp, stored bson.Raw) error {
+	if !isRecorded(model) {
+		return nil
+	}
+
+	var after bson.Raw
+	if _, soft := model.(SoftDeletable); op != AuditDelete || soft {
+		var err error
+		if after, err = bson.Marshal(model); err != nil {
+			return err
+		}
+	}
+
+	return recordDocument(ctx, coll, model, op, stored, after)
+}
+
+// recordDocument writes the audit record and the revision of a model's change
+// from the document before the change to the document after it.
+func recordDocument(ctx context.Context, coll *Collection, model Model, op AuditOp, before, after bson.Raw) error {
+	if op != AuditCreate && before == nil {
+		return nil
+	}
+
+	if err := audit(ctx, coll, model, op, before, after); err != nil {
+		return err
+	}
+
+	return saveRevision(ctx, coll, model, op, before, after)
+}
+
+// saveRevision copies the stored document of a revisioned model that is updated
+// or deleted into the revisions collection, then applies the model's retention
+// policy. Updates without changes don't make revisions.
+func saveRevision(ctx context.Context, coll *Collection, model Model, op AuditOp, stored, after bson.Raw) error {
+	r, ok := model.(Revisioned)
+	if !ok || stored == nil || op == AuditCreate {
+		return nil
+	}
+
+	if op == AuditUpdate {
+		set, unset := bson.M{}, bson.M{}
+		if diffDocuments("", stored, after, set, unset); len(set) == 0 && len(unset) == 0 {
+			return nil
+		}
+	}
+
+	number, err := coll.nextRevision(ctx, model.GetID())
+	if err != nil {
+		return err
+	}
+
+	revColl := coll.revisionCollection(ctx)
+	revision := &Revision{
+		DocumentID: model.GetID(),
+		Revision:   number,
+		Op:         op,
+		Document:   stored,
+		RevisedAt:  time.Now().UTC(),
+	}
+
+	if err := revColl.CreateWithCtx(ctx, revision); err != nil {
+		return err
+	}
+
+	if keep := int64(r.RevisionPolicy().KeepLast); keep > 0 && revision.Revision > keep {
+		filter := bson.M{"document_id": model.GetID(), "revision": bson.M{operator.Lte: revision.Revision - keep}}
+		if _, err := revColl.DeleteManyCtx(ctx, filter); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// nextRevision allocates the number of a document's next revision, using an
+// atomically incremented counter of the `<collection>_revision_counters` collection.
+func (coll *Collection) nextRevision(ctx context.Context, id interface{}) (int64, error) {
+	counters := coll.relatedCollection(ctx, coll.collection(ctx).Name()+"_revision_counters")
+
+	var counter struct {
+		Revision int64 `bson:"revision"`
+	}
+
+	opts := []*options.FindOneAndUpdateOptions{options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)}
+	op := &OpInfo{Op: OpFindOneAndUpdate, Filter: bson.M{field.ID: id}, Update: bson.M{operator.Inc: bson.M{"revision": 1}}, Options: opts}
+
+	err := counters.intercept(ctx, op, func(ctx context.Context, op *OpInfo) error {
+		opts, err := opOptions[*options.FindOneAndUpdateOptions](op)
+		if err != nil {
+			return err
+		}
+
+		return counters.collection(ctx).FindOneAndUpdate(ctx, op.Filter, op.Update, opts...).Decode(&counter)
+	})
+
+	return counter.Revision, err
+}
+
+// revisionIndexes returns the indexes of the revisions collection of a revisioned model.
+func revisionIndexes(r Revisioned) []mongo.IndexModel {
+	keys := bson.D{{Key: "document_id", Value: 1}, {Key: "revision", Value: 1}}
+	indexes := []mongo.IndexModel{{Keys: keys, Options: options.Index().SetName(indexName(keys)).SetUnique(true)}}
+
+	if ttl := r.RevisionPolicy().TTL; ttl > 0 {
+		keys := bson.D{{Key: "revised_at", Value: 1}}
+		opts := options.Index().SetName(indexName(keys)).SetExpireAfterSeconds(int32(ttl / time.Second))
+		indexes = append(indexes, mongo.IndexModel{Keys: keys, Options: opts})
+	}
+
+	return indexes
+}
@@ -0,0 +1,359 @@
+package mgm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uncle-gua/mgm"
+	"github.com/uncle-gua/mgm/internal/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+type Article struct {
+	mgm.IDField        `bson:",inline"`
+	mgm.RevisionFields `bson:",inline"`
+
+	Title string `bson:"title"`
+	Body  string `bson:"body,omitempty"`
+}
+
+type Page struct {
+	mgm.IDField `bson:",inline"`
+
+	Title string `bson:"title"`
+}
+
+func (p *Page) RevisionPolicy() mgm.RevisionPolicy {
+	return mgm.RevisionPolicy{KeepLast: 2, TTL: time.Hour}
+}
+
+func articleDoc(id primitive.ObjectID, title string) bson.D {
+	return bson.D{{Key: "_id", Value: id}, {Key: "title", Value: title}}
+}
+
+// counterResponse is the response of the revision counter's findAndModify.
+func counterResponse(revision int64) bson.D {
+	return mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{{Key: "revision", Value: revision}}})
+}
+
+func revisionDoc(id primitive.ObjectID, rev int64, revisedAt time.Time, doc bson.D) bson.D {
+	raw, _ := bson.Marshal(doc)
+
+	return bson.D{
+		{Key: "_id", Value: primitive.NewObjectID()},
+		{Key: "document_id", Value: id},
+		{Key: "revision", Value: rev},
+		{Key: "op", Value: "update"},
+		{Key: "document", Value: bson.Raw(raw)},
+		{Key: "revised_at", Value: revisedAt},
+	}
+}
+
+func TestUpdateSavesRevision(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		article := &Article{Title: "New"}
+		article.SetID(primitive.NewObjectID())
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.articles", mtest.FirstBatch, articleDoc(article.ID, "Old")),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			counterResponse(1),
+			mtest.CreateSuccessResponse(),
+		)
+
+		util.AssertErrIsNil(t, mgm.Coll(article).Update(article))
+
+		require.Equal(t, "find", mt.GetStartedEvent().CommandName)
+		require.Equal(t, "update", mt.GetStartedEvent().CommandName)
+
+		counter := mt.GetStartedEvent().Command
+		require.Equal(t, "articles_revision_counters", counter.Lookup("findAndModify").StringValue())
+		require.Equal(t, article.ID, counter.Lookup("query", "_id").ObjectID())
+		require.Equal(t, int64(1), counter.Lookup("update", "$inc", "revision").AsInt64())
+		require.True(t, counter.Lookup("upsert").Boolean())
+
+		evt := mt.GetStartedEvent()
+		require.Equal(t, "articles_revisions", evt.Command.Lookup("insert").StringValue())
+
+		revision := evt.Command.Lookup("documents").Array().Index(0).Value().Document()
+		require.Equal(t, article.ID, revision.Lookup("document_id").ObjectID())
+		require.Equal(t, int64(1), revision.Lookup("revision").AsInt64())
+		require.Equal(t, "update", revision.Lookup("op").StringValue())
+		require.Equal(t, "Old", revision.Lookup("document", "title").StringValue())
+	})
+}
+
+func TestUpdateWithoutChangesSavesNoRevision(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		article := &Article{Title: "Old"}
+		article.SetID(primitive.NewObjectID())
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.articles", mtest.FirstBatch, articleDoc(article.ID, "Old")),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		)
+
+		util.AssertErrIsNil(t, mgm.Coll(article).Update(article))
+
+		mt.GetStartedEvent()
+		mt.GetStartedEvent()
+		require.Nil(t, mt.GetStartedEvent())
+	})
+}
+
+func TestRevisionRetention(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		page := &Page{Title: "New"}
+		page.SetID(primitive.NewObjectID())
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.pages", mtest.FirstBatch, articleDoc(page.ID, "Old")),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			counterResponse(3),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		)
+
+		util.AssertErrIsNil(t, mgm.Coll(page).Delete(page))
+
+		require.Equal(t, "find", mt.GetStartedEvent().CommandName)
+		require.Equal(t, "delete", mt.GetStartedEvent().CommandName)
+		mt.GetStartedEvent()
+
+		revision := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		require.Equal(t, int64(3), revision.Lookup("revision").AsInt64())
+		require.Equal(t, "delete", revision.Lookup("op").StringValue())
+
+		prune := mt.GetStartedEvent().Command
+		require.Equal(t, "pages_revisions", prune.Lookup("delete").StringValue())
+		q := prune.Lookup("deletes").Array().Index(0).Value().Document().Lookup("q").Document()
+		require.Equal(t, int64(1), q.Lookup("revision", "$lte").AsInt64())
+	})
+}
+
+func TestRevisionDeleteModels(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		page := &Page{Title: "Old"}
+		page.SetID(primitive.NewObjectID())
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.pages", mtest.FirstBatch, articleDoc(page.ID, "Old")),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			counterResponse(1),
+			mtest.CreateSuccessResponse(),
+		)
+
+		_, err := mgm.Coll(page).DeleteModels(context.Background(), []mgm.Model{page})
+		util.AssertErrIsNil(t, err)
+
+		require.Equal(t, "find", mt.GetStartedEvent().CommandName)
+		require.Equal(t, "delete", mt.GetStartedEvent().CommandName)
+		mt.GetStartedEvent()
+
+		insert := mt.GetStartedEvent().Command
+		require.Equal(t, "pages_revisions", insert.Lookup("insert").StringValue())
+		revision := insert.Lookup("documents").Array().Index(0).Value().Document()
+		require.Equal(t, "delete", revision.Lookup("op").StringValue())
+		require.Equal(t, "Old", revision.Lookup("document", "title").StringValue())
+	})
+}
+
+func TestRevertTo(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		article := &Article{Title: "New", Body: "Draft"}
+		article.SetID(primitive.NewObjectID())
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.articles_revisions", mtest.FirstBatch,
+				revisionDoc(article.ID, 1, time.Now(), articleDoc(article.ID, "Old"))),
+			mtest.CreateCursorResponse(0, "db.articles", mtest.FirstBatch, bson.D{{Key: "_id", Value: article.ID}}),
+			mtest.CreateCursorResponse(0, "db.articles", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: article.ID}, {Key: "title", Value: "New"}, {Key: "body", Value: "Draft"},
+			}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			counterResponse(2),
+			mtest.CreateSuccessResponse(),
+		)
+
+		util.AssertErrIsNil(t, mgm.RevertTo(context.Background(), article, 1))
+		require.Equal(t, "Old", article.Title)
+		require.Empty(t, article.Body)
+
+		require.Equal(t, int64(1), mt.GetStartedEvent().Command.Lookup("filter", "revision").AsInt64())
+		mt.GetStartedEvent()
+		mt.GetStartedEvent()
+
+		upd := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		require.Equal(t, "Old", upd.Lookup("u", "title").StringValue())
+		_, err := upd.Lookup("u").Document().LookupErr("body")
+		require.Error(t, err)
+		_, err = upd.LookupErr("upsert")
+		require.Error(t, err)
+
+		mt.GetStartedEvent()
+		revision := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		require.Equal(t, int64(2), revision.Lookup("revision").AsInt64())
+		require.Equal(t, "Draft", revision.Lookup("document", "body").StringValue())
+	})
+}
+
+type Essay struct {
+	mgm.IDField        `bson:",inline"`
+	mgm.VersionField   `bson:",inline"`
+	mgm.RevisionFields `bson:",inline"`
+
+	Title string `bson:"title"`
+}
+
+func TestRevertToStaleModel(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		essay := &Essay{Title: "New"}
+		essay.SetID(primitive.NewObjectID())
+		essay.Version = 2
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.essays_revisions", mtest.FirstBatch,
+				revisionDoc(essay.ID, 1, time.Now(), articleDoc(essay.ID, "Old"))),
+			mtest.CreateCursorResponse(0, "db.essays", mtest.FirstBatch, bson.D{{Key: "_id", Value: essay.ID}}),
+			mtest.CreateCursorResponse(0, "db.essays", mtest.FirstBatch, articleDoc(essay.ID, "Newer")),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}),
+		)
+
+		err := mgm.RevertTo(context.Background(), essay, 1)
+		require.True(t, errors.Is(err, mgm.ErrVersionConflict))
+		require.Equal(t, "New", essay.Title)
+		require.Equal(t, int64(2), essay.Version)
+
+		mt.GetStartedEvent()
+		mt.GetStartedEvent()
+		mt.GetStartedEvent()
+		upd := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		require.Equal(t, int64(2), upd.Lookup("q", "_v").AsInt64())
+		_, err = upd.LookupErr("upsert")
+		require.Error(t, err)
+	})
+}
+
+func TestRevertToDeletedDocument(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		essay := &Essay{Title: "New"}
+		essay.SetID(primitive.NewObjectID())
+		essay.Version = 2
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.essays_revisions", mtest.FirstBatch,
+				revisionDoc(essay.ID, 1, time.Now(), articleDoc(essay.ID, "Old"))),
+			mtest.CreateCursorResponse(0, "db.essays", mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, "db.essays", mtest.FirstBatch),
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"}),
+		)
+
+		// The document is inserted again by another client, so the upsert fails.
+		err := mgm.RevertTo(context.Background(), essay, 1)
+
+		var conflict *mgm.VersionConflictError
+		require.True(t, errors.As(err, &conflict))
+		require.Equal(t, int64(2), conflict.Version)
+
+		mt.GetStartedEvent()
+		mt.GetStartedEvent()
+		mt.GetStartedEvent()
+		upd := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		require.True(t, upd.Lookup("upsert").Boolean())
+	})
+}
+
+func TestAsOf(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		at := time.Now().Add(-time.Hour)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.articles_revisions", mtest.FirstBatch,
+			revisionDoc(id, 1, time.Now(), articleDoc(id, "Old"))))
+
+		article, err := mgm.TypedColl[*Article]().AsOf(context.Background(), id, at)
+		util.AssertErrIsNil(t, err)
+		require.Equal(t, "Old", article.Title)
+
+		filter := mt.GetStartedEvent().Command.Lookup("filter")
+		require.Equal(t, id, filter.Document().Lookup("document_id").ObjectID())
+		require.Equal(t, at.UnixMilli(), filter.Document().Lookup("revised_at", "$gt").Time().UnixMilli())
+	})
+}
+
+func TestAsOfCurrentDocument(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.articles_revisions", mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, "db.articles", mtest.FirstBatch, articleDoc(id, "Current")),
+		)
+
+		article := &Article{}
+		util.AssertErrIsNil(t, mgm.Coll(article).AsOf(context.Background(), id, time.Now(), article))
+		require.Equal(t, "Current", article.Title)
+	})
+}
+
+func TestAsOfBeforeCreation(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.articles_revisions", mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, "db.articles", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: id}, {Key: "created_at", Value: time.Now()},
+			}),
+		)
+
+		article := &Article{}
+		err := mgm.Coll(article).AsOf(context.Background(), id, time.Now().Add(-time.Hour), article)
+		require.Equal(t, mongo.ErrNoDocuments, err)
+	})
+}
+
+func TestRevisions(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		article := &Article{}
+		article.SetID(primitive.NewObjectID())
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.articles_revisions", mtest.FirstBatch,
+			revisionDoc(article.ID, 1, time.Now(), articleDoc(article.ID, "First")),
+			revisionDoc(article.ID, 2, time.Now(), articleDoc(article.ID, "Second")),
+		))
+
+		revisions, err := mgm.Revisions(context.Background(), article)
+		util.AssertErrIsNil(t, err)
+		require.Len(t, revisions, 2)
+		require.Equal(t, int64(2), revisions[1].Revision)
+
+		old := &Article{}
+		util.AssertErrIsNil(t, revisions[0].Decode(old))
+		require.Equal(t, "First", old.Title)
+	})
+}
+
+func TestRevisionsNotRevisioned(t *testing.T) {
+	_, err := mgm.Revisions(context.Background(), &Doc{})
+	require.Equal(t, mgm.ErrNotRevisioned, err)
+}
+
+func TestRevisionIndexes(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		mt.AddMockResponses(indexesResponse("_id_"), indexesResponse("_id_"))
+
+		changes, err := mgm.SyncIndexes(context.Background(), true, &Page{})
+		util.AssertErrIsNil(t, err)
+		require.Equal(t, []mgm.IndexChange{
+			{Collection: "pages_revisions", Action: mgm.IndexCreate, Name: "document_id_1_revision_1"},
+			{Collection: "pages_revisions", Action: mgm.IndexCreate, Name: "revised_at_1"},
+		}, changes)
+	})
+}
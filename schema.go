@@ -0,0 +1,294 @@
+package mgm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uncle-gua/mgm/operator"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ValidationLevel determines which writes the database validates using a
+// collection's schema.
+type ValidationLevel string
+
+const (
+	// ValidationLevelOff disables the validation.
+	ValidationLevelOff ValidationLevel = "off"
+	// ValidationLevelStrict validates all inserts and updates.
+	ValidationLevelStrict ValidationLevel = "strict"
+	// ValidationLevelModerate validates inserts, and updates of valid documents.
+	ValidationLevelModerate ValidationLevel = "moderate"
+)
+
+// namespaceNotFound is the error code of commands on a collection that does not exist.
+const namespaceNotFound = 26
+
+// bsonTypes contains the bson types of the types that are not encoded
+// based on their kind.
+var bsonTypes = map[reflect.Type]string{
+	reflect.TypeOf(time.Time{}):            "date",
+	reflect.TypeOf(primitive.DateTime(0)):  "date",
+	reflect.TypeOf(primitive.ObjectID{}):   "objectId",
+	reflect.TypeOf(primitive.Decimal128{}): "decimal",
+	reflect.TypeOf(primitive.Binary{}):     "binData",
+	reflect.TypeOf(primitive.Timestamp{}):  "timestamp",
+	reflect.TypeOf(primitive.Regex{}):      "regex",
+	reflect.TypeOf([]byte{}):               "binData",
+}
+
+// JSONSchema returns the `$jsonSchema` of the model's documents. The schema is derived
+// from the model's bson tags, field types and validation tags. A field is required
+// unless it's a pointer or has the omitempty bson option, pointers, slices and maps
+// can be null. Like Validate, the validation rules of fields that are not `required`
+// accept the fields' zero values.
+func JSONSchema(m Model) (bson.D, error) {
+	return structSchema(reflect.TypeOf(m))
+}
+
+// ApplySchema sets the model's schema as the validator of its collection, creating the
+// collection if it does not exist. The database rejects the writes that don't match
+// the schema, according to the validation level.
+func ApplySchema(ctx context.Context, m Model, level ValidationLevel) error {
+	schema, err := JSONSchema(m)
+	if err != nil {
+		return err
+	}
+
+	c := Coll(m).collection(ctx)
+	validator := bson.M{operator.JSONSchema: schema}
+
+	cmd := bson.D{
+		{Key: "collMod", Value: c.Name()},
+		{Key: "validator", Value: validator},
+		{Key: "validationLevel", Value: string(level)},
+	}
+
+	err = c.Database().RunCommand(ctx, cmd).Err()
+
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == namespaceNotFound {
+		opts := options.CreateCollection().SetValidator(validator).SetValidationLevel(string(level))
+		return c.Database().CreateCollection(ctx, c.Name(), opts)
+	}
+
+	return err
+}
+
+func structSchema(t reflect.Type) (bson.D, error) {
+	properties := bson.D{}
+	required := bson.A{}
+
+	for _, f := range modelFields(t) {
+		// Nested structs' fields are part of their own schema.
+		if strings.Contains(f.path, ".") {
+			continue
+		}
+
+		schema, err := fieldSchema(f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema of field %s: %w", f.path, err)
+		}
+		properties = append(properties, bson.E{Key: f.path, Value: schema})
+
+		if f.mgm.has("required") || f.field.Type.Kind() != reflect.Ptr && !f.bson.OmitEmpty {
+			required = append(required, f.path)
+		}
+	}
+
+	schema := bson.D{{Key: "bsonType", Value: "object"}}
+	if len(required) != 0 {
+		schema = append(schema, bson.E{Key: "required", Value: required})
+	}
+
+	return append(schema, bson.E{Key: "properties", Value: properties}), nil
+}
+
+func fieldSchema(f modelField) (bson.D, error) {
+	schema, err := typeSchema(f.field.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	t := indirectType(f.field.Type)
+	rules := bson.D{}
+	for _, rule := range validationRules {
+		param, ok := f.mgm[rule]
+		if !ok {
+			continue
+		}
+
+		e, err := ruleSchema(t, rule, param)
+		if err != nil {
+			return nil, err
+		}
+		if e.Key != "" {
+			rules = append(rules, e)
+		}
+	}
+
+	if len(rules) == 0 {
+		return schema, nil
+	}
+
+	// The rules are not checked on zero values, unless the field is required.
+	zero, ok, err := zeroValue(f.field.Type)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || f.mgm.has("required") {
+		return append(schema, rules...), nil
+	}
+
+	return append(schema, bson.E{Key: "anyOf", Value: bson.A{bson.D{{Key: "enum", Value: bson.A{zero}}}, rules}}), nil
+}
+
+// zeroValue returns the zero value of a field type that the validation rules
+// would reject in the database. Other zero values (e.g nil pointers and slices)
+// are null, which the rules don't check.
+func zeroValue(t reflect.Type) (interface{}, bool, error) {
+	if _, ok := bsonTypes[t]; ok {
+		return nil, false, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "", true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		zero, err := enumValue(t, "0")
+		return zero, true, err
+	}
+
+	return nil, false, nil
+}
+
+func typeSchema(t reflect.Type) (bson.D, error) {
+	nullable := false
+	if t.Kind() == reflect.Ptr {
+		nullable = true
+		t = indirectType(t)
+	}
+
+	var schema bson.D
+	var bsonType interface{}
+
+	if name, ok := bsonTypes[t]; ok {
+		bsonType = name
+		nullable = nullable || t.Kind() == reflect.Slice
+	} else {
+		switch t.Kind() {
+		case reflect.String:
+			bsonType = "string"
+		case reflect.Bool:
+			bsonType = "bool"
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+			bsonType = "int"
+		case reflect.Int, reflect.Uint32:
+			// The driver encodes these types as int32 if the value fits.
+			bsonType = bson.A{"int", "long"}
+		case reflect.Int64, reflect.Uint, reflect.Uint64:
+			bsonType = "long"
+		case reflect.Float32, reflect.Float64:
+			bsonType = "double"
+		case reflect.Slice, reflect.Array:
+			items, err := typeSchema(t.Elem())
+			if err != nil {
+				return nil, err
+			}
+			bsonType = "array"
+			schema = bson.D{{Key: "items", Value: items}}
+			nullable = nullable || t.Kind() == reflect.Slice
+		case reflect.Map:
+			bsonType = "object"
+			nullable = true
+		case reflect.Struct:
+			if !isNestedStruct(t) {
+				// An unknown bson primitive, so any type is valid.
+				return bson.D{}, nil
+			}
+			nested, err := structSchema(t)
+			if err != nil {
+				return nil, err
+			}
+			schema = nested[1:]
+			bsonType = "object"
+		case reflect.Interface:
+			return bson.D{}, nil
+		default:
+			return nil, fmt.Errorf("unsupported type %s", t)
+		}
+	}
+
+	if nullable {
+		if types, ok := bsonType.(bson.A); ok {
+			bsonType = append(types, "null")
+		} else {
+			bsonType = bson.A{bsonType, "null"}
+		}
+	}
+
+	return append(bson.D{{Key: "bsonType", Value: bsonType}}, schema...), nil
+}
+
+// ruleSchema returns the schema keyword of a validation rule.
+func ruleSchema(t reflect.Type, rule, param string) (bson.E, error) {
+	switch rule {
+	case "min", "max":
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return bson.E{}, fmt.Errorf("invalid %s rule %q", rule, param)
+		}
+
+		keyword := map[string]string{"min": "minimum", "max": "maximum"}[rule]
+		switch t.Kind() {
+		case reflect.String:
+			keyword = rule + "Length"
+		case reflect.Slice, reflect.Array:
+			keyword = rule + "Items"
+		case reflect.Map:
+			keyword = rule + "Properties"
+		}
+
+		if keyword == "minimum" || keyword == "maximum" {
+			return bson.E{Key: keyword, Value: limit}, nil
+		}
+		return bson.E{Key: keyword, Value: int64(limit)}, nil
+	case "email":
+		return bson.E{Key: "pattern", Value: emailRegex.String()}, nil
+	case "oneof":
+		values := bson.A{}
+		for _, option := range strings.Fields(param) {
+			val, err := enumValue(t, option)
+			if err != nil {
+				return bson.E{}, err
+			}
+			values = append(values, val)
+		}
+		return bson.E{Key: "enum", Value: values}, nil
+	}
+
+	return bson.E{}, nil
+}
+
+// enumValue converts the option of the oneof rule to the field's type.
+func enumValue(t reflect.Type, option string) (interface{}, error) {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseInt(option, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(option, 64)
+	}
+
+	return option, nil
+}
@@ -0,0 +1,139 @@
+package mgm_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uncle-gua/mgm"
+	"github.com/uncle-gua/mgm/internal/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files")
+
+type Chapter struct {
+	Title string `bson:"title" mgm:"required,min=1"`
+	Pages int    `bson:"pages"`
+}
+
+type Manuscript struct {
+	mgm.DefaultModel     `bson:",inline"`
+	mgm.SoftDeleteFields `bson:",inline"`
+
+	Title       string            `bson:"title" mgm:"required,min=3,max=100"`
+	Status      string            `bson:"status" mgm:"oneof=draft published"`
+	Rating      int32             `bson:"rating" mgm:"oneof=1 2 3"`
+	Price       float64           `bson:"price" mgm:"min=0"`
+	Contact     string            `bson:"contact,omitempty" mgm:"email"`
+	Editor      *string           `bson:"editor"`
+	PublishedAt *time.Time        `bson:"published_at,omitempty"`
+	Tags        []string          `bson:"tags" mgm:"max=5"`
+	Chapters    []Chapter         `bson:"chapters"`
+	Meta        map[string]string `bson:"meta"`
+	Cover       []byte            `bson:"cover,omitempty"`
+	Extra       interface{}       `bson:"extra"`
+	Draft       Chapter           `bson:"draft"`
+}
+
+// assertGolden compares the schema to the golden file, or updates the
+// golden file when the tests run with the -update flag.
+func assertGolden(t *testing.T, name string, schema bson.D) {
+	ext, err := bson.MarshalExtJSON(schema, false, false)
+	util.AssertErrIsNil(t, err)
+
+	var got bytes.Buffer
+	util.AssertErrIsNil(t, json.Indent(&got, ext, "", "  "))
+	got.WriteByte('\n')
+
+	path := filepath.Join("testdata", "schema", name+".json")
+	if *updateGolden {
+		util.AssertErrIsNil(t, os.WriteFile(path, got.Bytes(), 0644))
+	}
+
+	want, err := os.ReadFile(path)
+	util.AssertErrIsNil(t, err)
+	require.Equal(t, string(want), got.String())
+}
+
+func TestJSONSchema(t *testing.T) {
+	schema, err := mgm.JSONSchema(&Manuscript{})
+	util.AssertErrIsNil(t, err)
+
+	assertGolden(t, "manuscript", schema)
+}
+
+func TestJSONSchemaOfDefaultModel(t *testing.T) {
+	schema, err := mgm.JSONSchema(&Doc{})
+	util.AssertErrIsNil(t, err)
+
+	assertGolden(t, "doc", schema)
+}
+
+type Listing struct {
+	mgm.DefaultModel `bson:",inline"`
+
+	Kind     string  `bson:"kind" mgm:"oneof=sale rent"`
+	Agent    string  `bson:"agent" mgm:"required,email"`
+	Rooms    int     `bson:"rooms" mgm:"min=1,max=10"`
+	Area     float64 `bson:"area" mgm:"min=10"`
+	Note     *string `bson:"note" mgm:"min=3"`
+	Features []int   `bson:"features" mgm:"min=1"`
+}
+
+// TestJSONSchemaOfOptionalRules checks that the rules of fields that are not
+// required accept their zero values, as the validation does.
+func TestJSONSchemaOfOptionalRules(t *testing.T) {
+	schema, err := mgm.JSONSchema(&Listing{})
+	util.AssertErrIsNil(t, err)
+
+	assertGolden(t, "listing", schema)
+}
+
+type Unsupported struct {
+	mgm.DefaultModel `bson:",inline"`
+
+	Callback func() `bson:"callback"`
+}
+
+func TestJSONSchemaOfUnsupportedType(t *testing.T) {
+	_, err := mgm.JSONSchema(&Unsupported{})
+	require.EqualError(t, err, "invalid schema of field callback: unsupported type func()")
+}
+
+func TestApplySchema(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		util.AssertErrIsNil(t, mgm.ApplySchema(context.Background(), &Account{coll: coll}, mgm.ValidationLevelModerate))
+
+		cmd := mt.GetStartedEvent().Command
+		require.Equal(t, coll.Name(), cmd.Lookup("collMod").StringValue())
+		require.Equal(t, "moderate", cmd.Lookup("validationLevel").StringValue())
+		require.Equal(t, "object", cmd.Lookup("validator", "$jsonSchema", "bsonType").StringValue())
+	})
+}
+
+func TestApplySchemaCreatesCollection(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 26, Name: "NamespaceNotFound", Message: "ns does not exist"}),
+			mtest.CreateSuccessResponse(),
+		)
+
+		util.AssertErrIsNil(t, mgm.ApplySchema(context.Background(), &Account{coll: coll}, mgm.ValidationLevelStrict))
+
+		require.Equal(t, "collMod", mt.GetStartedEvent().CommandName)
+
+		create := mt.GetStartedEvent().Command
+		require.Equal(t, coll.Name(), create.Lookup("create").StringValue())
+		require.Equal(t, "strict", create.Lookup("validationLevel").StringValue())
+	})
+}
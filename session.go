@@ -0,0 +1,92 @@
+package mgm
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrOutsideTransaction is returned in the strict sessions mode when a collection's
+// operation is called without a session while a transaction is running.
+var ErrOutsideTransaction = errors.New("operation is called without the session of the running transaction")
+
+// txClients counts the transactions that are running with each client.
+var txClients = map[*mongo.Client]int{}
+var txClientsMu sync.Mutex
+
+// InSession returns a copy of the collection whose operations use the session of the
+// context (e.g the context of a transaction function), even if they're called with
+// another context. The collection's methods that don't get a context pass the
+// session to the model's hooks too.
+func (coll *Collection) InSession(ctx context.Context) *Collection {
+	c := *coll
+	c.session = mongo.SessionFromContext(ctx)
+	return &c
+}
+
+// sessionCtx returns the context of the collection's session, or the context
+// itself if it already has a session or the collection is not bound to any session.
+func (coll *Collection) sessionCtx(ctx context.Context) context.Context {
+	if coll.session == nil || mongo.SessionFromContext(ctx) != nil {
+		return ctx
+	}
+
+	return mongo.NewSessionContext(ctx, coll.session)
+}
+
+// checkSession returns ErrOutsideTransaction if the connection uses the strict
+// sessions mode, the context has no session and a transaction of the
+// connection's client is running.
+func (coll *Collection) checkSession(ctx context.Context) error {
+	if coll.conn == nil || !coll.conn.config.StrictSessions || mongo.SessionFromContext(ctx) != nil {
+		return nil
+	}
+
+	txClientsMu.Lock()
+	defer txClientsMu.Unlock()
+
+	if txClients[coll.conn.client] != 0 {
+		return ErrOutsideTransaction
+	}
+
+	return nil
+}
+
+// trackTransaction marks a transaction of the client as running, until the
+// returned function is called. Transactions are just tracked if a connection
+// of the client uses the strict sessions mode.
+func trackTransaction(client *mongo.Client) func() {
+	if !strictClient(client) {
+		return func() {}
+	}
+
+	txClientsMu.Lock()
+	txClients[client]++
+	txClientsMu.Unlock()
+
+	return func() {
+		txClientsMu.Lock()
+		defer txClientsMu.Unlock()
+
+		if txClients[client]--; txClients[client] == 0 {
+			delete(txClients, client)
+		}
+	}
+}
+
+// strictClient returns true if a registered connection of the client
+// uses the strict sessions mode.
+func strictClient(client *mongo.Client) bool {
+	connectionsMu.RLock()
+	defer connectionsMu.RUnlock()
+
+	for _, conn := range connections {
+		if conn.client == client && conn.config.StrictSessions {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,146 @@
+package mgm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uncle-gua/mgm"
+	"github.com/uncle-gua/mgm/internal/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// runStrictMock runs the test callback with a default connection that uses
+// the strict sessions mode and is backed by the driver's mock deployment.
+func runStrictMock(t *testing.T, fn func(mt *mtest.T)) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("mock", func(mt *mtest.T) {
+		conf := &mgm.Config{CtxTimeout: 10 * time.Second, StrictSessions: true}
+		mgm.RegisterConnection(mgm.NewConnection(mgm.DefaultConnectionName, conf, mt.Client, "db"))
+		defer mgm.ResetDefaultConfig()
+
+		fn(mt)
+	})
+}
+
+func TestInSession(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+
+		session, err := mt.Client.StartSession()
+		util.AssertErrIsNil(t, err)
+		defer session.EndSession(context.Background())
+
+		coll := mgm.Coll(&Doc{}).InSession(mongo.NewSessionContext(context.Background(), session))
+
+		util.AssertErrIsNil(t, coll.CreateWithCtx(context.Background(), NewDoc("Ali", 24)))
+		util.AssertErrIsNil(t, coll.Create(NewDoc("Mehran", 24)))
+
+		require.Equal(t, session.ID().Lookup("id"), mt.GetStartedEvent().Command.Lookup("lsid", "id"))
+		require.Equal(t, session.ID().Lookup("id"), mt.GetStartedEvent().Command.Lookup("lsid", "id"))
+	})
+}
+
+func TestStrictSessions(t *testing.T) {
+	runStrictMock(t, func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		err := mgm.WithTransaction(context.Background(), func(ctx context.Context) error {
+			return mgm.Coll(&Doc{}).CreateWithCtx(context.Background(), NewDoc("Ali", 24))
+		})
+		require.True(t, errors.Is(err, mgm.ErrOutsideTransaction))
+		require.Nil(t, mt.GetStartedEvent())
+
+		// Operations outside of transactions don't need a session.
+		util.AssertErrIsNil(t, mgm.Coll(&Doc{}).CreateWithCtx(context.Background(), NewDoc("Ali", 24)))
+	})
+}
+
+func TestStrictSessionsAllowsInSession(t *testing.T) {
+	runStrictMock(t, func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+
+		err := mgm.WithTransaction(context.Background(), func(ctx context.Context) error {
+			if err := mgm.Coll(&Doc{}).CreateWithCtx(ctx, NewDoc("Ali", 24)); err != nil {
+				return err
+			}
+			return mgm.Coll(&Doc{}).InSession(ctx).Create(NewDoc("Mehran", 24))
+		})
+		util.AssertErrIsNil(t, err)
+
+		first, second := mt.GetStartedEvent(), mt.GetStartedEvent()
+		require.Equal(t, first.Command.Lookup("txnNumber"), second.Command.Lookup("txnNumber"))
+		require.Equal(t, "commitTransaction", mt.GetStartedEvent().CommandName)
+	})
+}
+
+func TestStrictSessionsChecksOtherGoroutines(t *testing.T) {
+	runStrictMock(t, func(mt *mtest.T) {
+		err := mgm.WithTransaction(context.Background(), func(ctx context.Context) error {
+			done := make(chan error)
+			go func() {
+				done <- mgm.Coll(&Doc{}).CreateWithCtx(context.Background(), NewDoc("Ali", 24))
+			}()
+			return <-done
+		})
+		require.True(t, errors.Is(err, mgm.ErrOutsideTransaction))
+		require.Nil(t, mt.GetStartedEvent())
+	})
+}
+
+func TestStrictSessionsChecksFindOne(t *testing.T) {
+	runStrictMock(t, func(mt *mtest.T) {
+		err := mgm.WithTransaction(context.Background(), func(ctx context.Context) error {
+			return mgm.Coll(&Doc{}).FindOneWithCtx(context.Background(), bson.M{}).Err()
+		})
+
+		var marshalErr mongo.MarshalError
+		require.True(t, errors.As(err, &marshalErr))
+		require.Equal(t, mgm.ErrOutsideTransaction, marshalErr.Err)
+		require.Nil(t, mt.GetStartedEvent())
+	})
+}
+
+func TestStrictSessionsIgnoresLenientConnections(t *testing.T) {
+	runStrictMock(t, func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		conf := &mgm.Config{CtxTimeout: 10 * time.Second}
+		mgm.RegisterConnection(mgm.NewConnection("lenient", conf, mt.Client, "db"))
+		defer mgm.RemoveConnection("lenient")
+
+		// Another connection of the client runs operations outside of the transaction.
+		err := mgm.WithTransaction(context.Background(), func(ctx context.Context) error {
+			return mgm.Use("lenient").Coll(&Doc{}).CreateWithCtx(context.Background(), NewDoc("Ali", 24))
+		})
+		util.AssertErrIsNil(t, err)
+
+		_, err = mt.GetStartedEvent().Command.LookupErr("autocommit")
+		require.Error(t, err)
+	})
+}
+
+func TestStrictSessionsIgnoresOtherClients(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		other, err := mongo.NewClient()
+		util.AssertErrIsNil(t, err)
+
+		conf := &mgm.Config{CtxTimeout: 10 * time.Second, StrictSessions: true}
+		mgm.RegisterConnection(mgm.NewConnection("strict", conf, other, "db"))
+		defer mgm.RemoveConnection("strict")
+
+		// The transaction of the default client is not tracked, its connection
+		// doesn't use the strict sessions mode.
+		err = mgm.WithTransaction(context.Background(), func(ctx context.Context) error {
+			return mgm.Use("strict").Coll(&Doc{}).CreateWithCtx(context.Background(), NewDoc("Ali", 24))
+		})
+		require.Error(t, err)
+		require.False(t, errors.Is(err, mgm.ErrOutsideTransaction))
+	})
+}
@@ -0,0 +1,122 @@
+package mgm
+
+import (
+	"context"
+	"strings"
+
+	"github.com/uncle-gua/mgm/field"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UpdateFields method persists only the specified fields of a model to the database.
+// Nested fields are specified by their dotted bson path (e.g "profile.age").
+// Fields changed by the model's hooks (e.g `updated_at`) are persisted too.
+func (coll *Collection) UpdateFields(model Model, fields ...string) error {
+	ctx, cancel := coll.ctx()
+	defer cancel()
+
+	return coll.UpdateFieldsWithCtx(ctx, model, fields...)
+}
+
+// UpdateFieldsWithCtx method persists only the specified fields of a model to the database
+// using the specified context.
+func (coll *Collection) UpdateFieldsWithCtx(ctx context.Context, model Model, fields ...string) error {
+	if fields == nil {
+		fields = []string{}
+	}
+
+	return updateFields(ctx, coll, model, fields)
+}
+
+// takeSnapshot stores the current state of the model if it implements Snapshotter.
+func takeSnapshot(model Model) error {
+	s, ok := model.(Snapshotter)
+	if !ok {
+		return nil
+	}
+
+	raw, err := bson.Marshal(model)
+	if err != nil {
+		return err
+	}
+
+	s.SetSnapshot(raw)
+	return nil
+}
+
+// updateDocument returns the update document of a model. If fields is not nil,
+// it contains the specified fields and the fields changed since the `before`
+// state. Otherwise, it contains the fields changed since the model's snapshot,
+// or the whole model if there is no snapshot to compare with.
+func updateDocument(model Model, fields []string, before bson.Raw, opts []*options.UpdateOptions) (bson.M, error) {
+	if fields == nil {
+		s, ok := model.(Snapshotter)
+		if !ok || s.Snapshot() == nil || isUpsert(opts) {
+			return bson.M{"$set": model}, nil
+		}
+		before = s.Snapshot()
+	}
+
+	after, err := bson.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+
+	set, unset := bson.M{}, bson.M{}
+	diffDocuments("", before, after, set, unset)
+
+	for _, f := range fields {
+		if val, err := bson.Raw(after).LookupErr(strings.Split(f, ".")...); err == nil {
+			set[f] = val
+		} else {
+			unset[f] = ""
+		}
+	}
+
+	delete(set, field.ID)
+
+	doc := bson.M{}
+	if len(set) != 0 {
+		doc["$set"] = set
+	}
+	if len(unset) != 0 {
+		doc["$unset"] = unset
+	}
+
+	return doc, nil
+}
+
+// diffDocuments puts the paths of the changed fields of the new document
+// into the set map and paths of the removed fields into the unset map.
+// Embedded documents are compared field by field, other values (including arrays)
+// are compared as a whole.
+func diffDocuments(prefix string, old, new bson.Raw, set, unset bson.M) {
+	newElems, _ := new.Elements()
+	for _, elem := range newElems {
+		key := elem.Key()
+		newVal := elem.Value()
+		oldVal, err := old.LookupErr(key)
+
+		switch {
+		case err != nil:
+			set[prefix+key] = newVal
+		case oldVal.Type == bson.TypeEmbeddedDocument && newVal.Type == bson.TypeEmbeddedDocument:
+			diffDocuments(prefix+key+".", oldVal.Document(), newVal.Document(), set, unset)
+		case !oldVal.Equal(newVal):
+			set[prefix+key] = newVal
+		}
+	}
+
+	oldElems, _ := old.Elements()
+	for _, elem := range oldElems {
+		if _, err := new.LookupErr(elem.Key()); err != nil {
+			unset[prefix+elem.Key()] = ""
+		}
+	}
+}
+
+func isUpsert(opts []*options.UpdateOptions) bool {
+	o := options.MergeUpdateOptions(opts...)
+	return o.Upsert != nil && *o.Upsert
+}
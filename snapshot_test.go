@@ -0,0 +1,110 @@
+package mgm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uncle-gua/mgm"
+	"github.com/uncle-gua/mgm/internal/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+type Profile struct {
+	Age  int    `bson:"age"`
+	City string `bson:"city"`
+}
+
+type Member struct {
+	mgm.DefaultModel  `bson:",inline"`
+	mgm.SnapshotField `bson:",inline"`
+
+	Name     string   `bson:"name"`
+	Nickname *string  `bson:"nickname,omitempty"`
+	Profile  Profile  `bson:"profile"`
+	Tags     []string `bson:"tags"`
+}
+
+// loadMember loads a member through First, so mgm takes its snapshot.
+func loadMember(t *testing.T, mt *mtest.T, coll *mgm.Collection) *Member {
+	mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch, bson.D{
+		{Key: "_id", Value: primitive.NewObjectID()},
+		{Key: "name", Value: "Ali"},
+		{Key: "nickname", Value: "Al"},
+		{Key: "profile", Value: bson.D{{Key: "age", Value: 24}, {Key: "city", Value: "Tehran"}}},
+		{Key: "tags", Value: bson.A{"a", "b"}},
+	}))
+
+	m := &Member{}
+	util.AssertErrIsNil(t, coll.FirstWithCtx(context.Background(), bson.M{}, m))
+	mt.ClearEvents()
+
+	return m
+}
+
+// updateSent returns the update document of the last sent update command.
+func updateSent(mt *mtest.T) bson.Raw {
+	return mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+}
+
+func keysOf(doc bson.Raw) []string {
+	elems, _ := doc.Elements()
+	keys := make([]string, len(elems))
+	for i, e := range elems {
+		keys[i] = e.Key()
+	}
+
+	return keys
+}
+
+func TestUpdateSendsChangedFields(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		m := loadMember(t, mt, coll)
+
+		m.Name = "Reza"
+		m.Profile.Age = 25
+		m.Nickname = nil
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+		util.AssertErrIsNil(t, coll.UpdateWithCtx(context.Background(), m))
+
+		u := updateSent(mt)
+		require.ElementsMatch(t, []string{"name", "profile.age", "updated_at"}, keysOf(u.Lookup("$set").Document()))
+		require.Equal(t, "Reza", u.Lookup("$set", "name").StringValue())
+
+		_, err := u.LookupErr("$unset", "nickname")
+		util.AssertErrIsNil(t, err)
+	})
+}
+
+func TestUpdateWithoutSnapshotSetsWholeModel(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+
+		m := &Member{Name: "Ali"}
+		util.AssertErrIsNil(t, coll.UpdateWithCtx(context.Background(), m))
+
+		u := updateSent(mt)
+		require.Equal(t, "Ali", u.Lookup("$set", "name").StringValue())
+		require.Equal(t, int64(0), u.Lookup("$set", "profile", "age").AsInt64())
+	})
+}
+
+func TestUpdateFields(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		m := loadMember(t, mt, coll)
+
+		m.Name = "Reza"
+		m.Profile.Age = 30
+		m.Profile.City = "Shiraz"
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+		util.AssertErrIsNil(t, coll.UpdateFieldsWithCtx(context.Background(), m, "name", "profile.age"))
+
+		u := updateSent(mt)
+		require.ElementsMatch(t, []string{"name", "profile.age", "updated_at"}, keysOf(u.Lookup("$set").Document()))
+		require.Equal(t, int64(30), u.Lookup("$set", "profile.age").AsInt64())
+	})
+}
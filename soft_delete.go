@@ -0,0 +1,149 @@
+package mgm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"github.com/uncle-gua/mgm/field"
+	"github.com/uncle-gua/mgm/internal/util"
+	"github.com/uncle-gua/mgm/operator"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrNotSoftDeletable is returned when a soft delete operation is
+// requested for a model that does not implement SoftDeletable.
+var ErrNotSoftDeletable = errors.New("model does not support soft delete")
+
+// trashedScope determines which soft-deleted documents a collection sees.
+type trashedScope int
+
+const (
+	withoutTrashed trashedScope = iota
+	withTrashed
+	onlyTrashed
+)
+
+// WithTrashed returns a copy of the collection that includes soft-deleted documents.
+func (coll *Collection) WithTrashed() *Collection {
+	c := *coll
+	c.trashed = withTrashed
+	return &c
+}
+
+// OnlyTrashed returns a copy of the collection that only sees soft-deleted documents.
+func (coll *Collection) OnlyTrashed() *Collection {
+	c := *coll
+	c.trashed = onlyTrashed
+	return &c
+}
+
+// Restore method restores a soft-deleted model.
+func (coll *Collection) Restore(model Model) error {
+	ctx, cancel := coll.ctx()
+	defer cancel()
+
+	return coll.RestoreWithCtx(ctx, model)
+}
+
+// RestoreWithCtx method restores a soft-deleted model using the specified context.
+func (coll *Collection) RestoreWithCtx(ctx context.Context, model Model) error {
+	return restore(ctx, coll, model)
+}
+
+// ForceDelete method removes a model (doc) from the collection, even if the model supports soft delete.
+func (coll *Collection) ForceDelete(model Model) error {
+	ctx, cancel := coll.ctx()
+	defer cancel()
+
+	return coll.ForceDeleteWithCtx(ctx, model)
+}
+
+// ForceDeleteWithCtx method removes a model (doc) from the collection using the specified context,
+// even if the model supports soft delete.
+func (coll *Collection) ForceDeleteWithCtx(ctx context.Context, model Model) error {
+	return forceDel(ctx, coll, model)
+}
+
+// forModel returns the collection configured for the model's soft delete support
+// and whether its changes are recorded.
+func (coll *Collection) forModel(m Model) *Collection {
+	_, soft := m.(SoftDeletable)
+	recorded := isRecorded(m)
+
+	if (!soft || coll.softDelete) && (!recorded || coll.recorded) {
+		return coll
+	}
+
+	c := *coll
+	c.softDelete = c.softDelete || soft
+	c.recorded = c.recorded || recorded
+	return &c
+}
+
+var softDeletableType = reflect.TypeOf((*SoftDeletable)(nil)).Elem()
+
+// forResults returns the collection configured for the soft delete support of
+// the results' models, if the results are a pointer to a slice of models. So the
+// trashed scope applies even if the collection is not got by a model (e.g
+// CollectionByName).
+func (coll *Collection) forResults(results interface{}) *Collection {
+	v, ok := modelsOf(results, []reflect.Type{softDeletableType})
+	if !ok {
+		return coll
+	}
+
+	t := v.Type().Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if m, ok := reflect.New(t).Interface().(Model); ok {
+		return coll.forModel(m)
+	}
+
+	return coll
+}
+
+// trashedFilter returns the filter that selects documents of the
+// collection's trashed scope, or nil if no filter is needed.
+func (coll *Collection) trashedFilter() bson.M {
+	if !coll.softDelete {
+		return nil
+	}
+
+	switch coll.trashed {
+	case withoutTrashed:
+		return bson.M{field.DeletedAt: nil}
+	case onlyTrashed:
+		return bson.M{field.DeletedAt: bson.M{operator.Ne: nil}}
+	}
+
+	return nil
+}
+
+// scopeFilter merges the collection's trashed scope into the filter.
+func (coll *Collection) scopeFilter(filter interface{}) interface{} {
+	scope := coll.trashedFilter()
+
+	if scope == nil {
+		return filter
+	}
+
+	if util.IsNil(filter) {
+		return scope
+	}
+
+	return bson.M{operator.And: bson.A{filter, scope}}
+}
+
+// scopeStages prepends the collection's trashed scope as a $match stage.
+func (coll *Collection) scopeStages(stages []interface{}) []interface{} {
+	scope := coll.trashedFilter()
+
+	if scope == nil {
+		return stages
+	}
+
+	return append([]interface{}{bson.M{operator.Match: scope}}, stages...)
+}
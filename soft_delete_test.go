@@ -0,0 +1,176 @@
+package mgm_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uncle-gua/mgm"
+	"github.com/uncle-gua/mgm/internal/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+type Post struct {
+	mgm.DefaultModel     `bson:",inline"`
+	mgm.SoftDeleteFields `bson:",inline"`
+
+	Title string `bson:"title"`
+
+	deleting int
+	deleted  *mongo.DeleteResult
+}
+
+func (p *Post) Deleting(ctx context.Context) error {
+	p.deleting++
+	return nil
+}
+
+func (p *Post) Deleted(ctx context.Context, result *mongo.DeleteResult) error {
+	p.deleted = result
+	return nil
+}
+
+// softColl returns the collection of the Post model on top of the mocked collection.
+func softColl(coll *mgm.Collection) *mgm.Collection {
+	return mgm.NewTypedCollection[*Post](coll).Collection()
+}
+
+func TestSoftDelete(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(
+			bson.E{Key: "n", Value: 1},
+			bson.E{Key: "nModified", Value: 1},
+		))
+
+		post := &Post{Title: "hello"}
+		post.ID = primitive.NewObjectID()
+
+		util.AssertErrIsNil(t, softColl(coll).DeleteWithCtx(context.Background(), post))
+
+		evt := mt.GetStartedEvent()
+		require.Equal(t, "update", evt.CommandName)
+
+		upd := evt.Command.Lookup("updates").Array().Index(0).Value().Document()
+		require.Equal(t, post.ID, upd.Lookup("q", "_id").ObjectID())
+		require.Equal(t, bson.TypeNull, upd.Lookup("q", "deleted_at").Type)
+		require.Equal(t, bson.TypeDateTime, upd.Lookup("u", "$set", "deleted_at").Type)
+
+		require.True(t, post.IsDeleted())
+		require.Equal(t, int64(1), post.deleted.DeletedCount)
+	})
+}
+
+func TestSoftDelete_ForceDelete(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+
+		post := &Post{}
+		util.AssertErrIsNil(t, softColl(coll).ForceDeleteWithCtx(context.Background(), post))
+
+		require.Equal(t, "delete", mt.GetStartedEvent().CommandName)
+		require.Equal(t, int64(1), post.deleted.DeletedCount)
+	})
+}
+
+func TestSoftDelete_Restore(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+
+		now := time.Now()
+		post := &Post{}
+		post.SetDeletedAt(&now)
+		util.AssertErrIsNil(t, softColl(coll).RestoreWithCtx(context.Background(), post))
+
+		upd := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		_, err := upd.LookupErr("u", "$unset", "deleted_at")
+		util.AssertErrIsNil(t, err)
+		require.False(t, post.IsDeleted())
+
+		require.Equal(t, mgm.ErrNotSoftDeletable, coll.RestoreWithCtx(context.Background(), &Doc{}))
+	})
+}
+
+func TestSoftDelete_ScopesFilters(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		ctx := context.Background()
+		posts := softColl(coll)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch, bson.D{}))
+		util.AssertErrIsNil(t, posts.FirstWithCtx(ctx, bson.M{"title": "hello"}, &Post{}))
+
+		and := mt.GetStartedEvent().Command.Lookup("filter", "$and").Array()
+		require.Equal(t, "hello", and.Index(0).Value().Document().Lookup("title").StringValue())
+		require.Equal(t, bson.TypeNull, and.Index(1).Value().Document().Lookup("deleted_at").Type)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch))
+		util.AssertErrIsNil(t, posts.OnlyTrashed().SimpleFindWithCtx(ctx, &[]Post{}, nil))
+
+		filter := mt.GetStartedEvent().Command.Lookup("filter")
+		require.Equal(t, bson.TypeNull, filter.Document().Lookup("deleted_at", "$ne").Type)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch))
+		util.AssertErrIsNil(t, posts.WithTrashed().SimpleFindWithCtx(ctx, &[]Post{}, bson.M{}))
+
+		filter = mt.GetStartedEvent().Command.Lookup("filter")
+		elems, _ := filter.Document().Elements()
+		require.Len(t, elems, 0)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch))
+		util.AssertErrIsNil(t, posts.SimpleAggregateWithCtx(ctx, &[]Post{}, bson.M{"$sort": bson.M{"title": 1}}))
+
+		pipeline := mt.GetStartedEvent().Command.Lookup("pipeline").Array()
+		require.Equal(t, bson.TypeNull, pipeline.Index(0).Value().Document().Lookup("$match", "deleted_at").Type)
+	})
+}
+
+func TestSoftDelete_DoesNotScopeRegularModels(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch))
+		util.AssertErrIsNil(t, coll.SimpleFindWithCtx(context.Background(), &[]Doc{}, bson.M{"age": 1}))
+
+		filter := mt.GetStartedEvent().Command.Lookup("filter")
+		require.Equal(t, int64(1), filter.Document().Lookup("age").AsInt64())
+	})
+}
+
+func TestSoftDelete_ScopesCollectionsByName(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		ctx := context.Background()
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch, bson.D{}))
+		util.AssertErrIsNil(t, coll.FindByIDWithCtx(ctx, primitive.NewObjectID(), &Post{}))
+
+		and := mt.GetStartedEvent().Command.Lookup("filter", "$and").Array()
+		require.Equal(t, bson.TypeNull, and.Index(1).Value().Document().Lookup("deleted_at").Type)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch))
+		util.AssertErrIsNil(t, coll.SimpleFindWithCtx(ctx, &[]*Post{}, nil))
+
+		filter := mt.GetStartedEvent().Command.Lookup("filter")
+		require.Equal(t, bson.TypeNull, filter.Document().Lookup("deleted_at").Type)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch))
+		util.AssertErrIsNil(t, coll.OnlyTrashed().SimpleAggregateWithCtx(ctx, &[]Post{}))
+
+		pipeline := mt.GetStartedEvent().Command.Lookup("pipeline").Array()
+		require.Equal(t, bson.TypeNull, pipeline.Index(0).Value().Document().Lookup("$match", "deleted_at", "$ne").Type)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch))
+		_, err := coll.SimpleAggregateFirstWithCtx(ctx, &Post{})
+		util.AssertErrIsNil(t, err)
+
+		pipeline = mt.GetStartedEvent().Command.Lookup("pipeline").Array()
+		require.Equal(t, bson.TypeNull, pipeline.Index(0).Value().Document().Lookup("$match", "deleted_at").Type)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch, bson.D{{Key: "metadata", Value: bson.A{}}, {Key: "data", Value: bson.A{}}}))
+		_, err = coll.PaginateAggregate(ctx, 1, 10, &[]Post{})
+		util.AssertErrIsNil(t, err)
+
+		pipeline = mt.GetStartedEvent().Command.Lookup("pipeline").Array()
+		require.Equal(t, bson.TypeNull, pipeline.Index(0).Value().Document().Lookup("$match", "deleted_at").Type)
+	})
+}
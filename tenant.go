@@ -0,0 +1,86 @@
+package mgm
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TenantResolver returns the tenant of a context, or an empty string if
+// the context does not belong to any tenant.
+type TenantResolver func(ctx context.Context) string
+
+// TenantStrategy determines how the collections of a tenant are stored.
+type TenantStrategy int
+
+const (
+	// TenantDatabase strategy stores the collections of each tenant in the
+	// tenant's database (e.g "acme.books").
+	TenantDatabase TenantStrategy = iota
+	// TenantCollectionPrefix strategy stores the collections of each tenant in the
+	// connection's database, prefixed by the tenant's name (e.g "acme_books").
+	TenantCollectionPrefix
+)
+
+type tenantCtxKey struct{}
+
+// WithTenant returns a copy of the context that belongs to the tenant. The `...WithCtx`
+// methods of the collections of a connection route to the tenant's collections.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantCtxKey{}, tenant)
+}
+
+// TenantFromCtx returns the tenant that is set on the context by WithTenant.
+func TenantFromCtx(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantCtxKey{}).(string)
+	return tenant
+}
+
+type tenantCollKey struct {
+	tenant string
+	name   string
+}
+
+// tenant returns the tenant of the context using the connection's resolver.
+func (conn *Connection) tenant(ctx context.Context) string {
+	if conn.config.TenantResolver != nil {
+		return conn.config.TenantResolver(ctx)
+	}
+
+	return TenantFromCtx(ctx)
+}
+
+// collection returns the mongo collection of the context's tenant. Collections
+// that do not belong to a connection (e.g created by NewCollection) are not routed.
+func (coll *Collection) collection(ctx context.Context) *mongo.Collection {
+	if coll.conn == nil {
+		return coll.c
+	}
+
+	tenant := coll.conn.tenant(ctx)
+	if tenant == "" {
+		return coll.c
+	}
+
+	// Collections with options are not cached, because the options are part of them.
+	if len(coll.opts) != 0 {
+		return coll.conn.tenantCollection(tenant, coll.c.Name(), coll.opts)
+	}
+
+	key := tenantCollKey{tenant: tenant, name: coll.c.Name()}
+	if c, ok := coll.conn.tenantColls.Load(key); ok {
+		return c.(*mongo.Collection)
+	}
+
+	c, _ := coll.conn.tenantColls.LoadOrStore(key, coll.conn.tenantCollection(tenant, coll.c.Name(), nil))
+	return c.(*mongo.Collection)
+}
+
+func (conn *Connection) tenantCollection(tenant, name string, opts []*options.CollectionOptions) *mongo.Collection {
+	if conn.config.TenantStrategy == TenantCollectionPrefix {
+		return conn.db.Collection(tenant+"_"+name, opts...)
+	}
+
+	return conn.client.Database(tenant).Collection(name, opts...)
+}
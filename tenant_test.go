@@ -0,0 +1,66 @@
+package mgm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uncle-gua/mgm"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// findNamespace runs a find on the books collection using the context and
+// returns the database and collection names of the sent command.
+func findNamespace(ctx context.Context, mt *mtest.T, coll *mgm.Collection) (string, string) {
+	mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.books", mtest.FirstBatch))
+
+	var books []Doc
+	require.NoError(mt, coll.SimpleFindWithCtx(ctx, &books, bson.M{}))
+
+	evt := mt.GetStartedEvent()
+	return evt.DatabaseName, evt.Command.Lookup("find").StringValue()
+}
+
+func runTenantMock(t *testing.T, conf *mgm.Config, fn func(mt *mtest.T, coll *mgm.Collection)) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("mock", func(mt *mtest.T) {
+		fn(mt, mgm.NewConnection("tenants", conf, mt.Client, "main").CollectionByName("books"))
+	})
+}
+
+func TestTenantDatabase(t *testing.T) {
+	runTenantMock(t, nil, func(mt *mtest.T, coll *mgm.Collection) {
+		db, name := findNamespace(mgm.WithTenant(context.Background(), "acme"), mt, coll)
+		require.Equal(t, "acme", db)
+		require.Equal(t, "books", name)
+
+		db, name = findNamespace(context.Background(), mt, coll)
+		require.Equal(t, "main", db)
+		require.Equal(t, "books", name)
+	})
+}
+
+func TestTenantCollectionPrefix(t *testing.T) {
+	runTenantMock(t, &mgm.Config{TenantStrategy: mgm.TenantCollectionPrefix}, func(mt *mtest.T, coll *mgm.Collection) {
+		db, name := findNamespace(mgm.WithTenant(context.Background(), "acme"), mt, coll)
+		require.Equal(t, "main", db)
+		require.Equal(t, "acme_books", name)
+	})
+}
+
+func TestTenantResolver(t *testing.T) {
+	resolver := func(ctx context.Context) string {
+		if tenant := mgm.TenantFromCtx(ctx); tenant != "" {
+			return "tenant_" + tenant
+		}
+		return ""
+	}
+
+	runTenantMock(t, &mgm.Config{TenantResolver: resolver}, func(mt *mtest.T, coll *mgm.Collection) {
+		db, _ := findNamespace(mgm.WithTenant(context.Background(), "acme"), mt, coll)
+		require.Equal(t, "tenant_acme", db)
+	})
+}
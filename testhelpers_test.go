@@ -6,6 +6,7 @@ import (
 	"github.com/uncle-gua/mgm"
 	"github.com/uncle-gua/mgm/internal/util"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -15,6 +16,31 @@ func setupDefConnection() {
 	)
 }
 
+// runMock runs the test callback against a collection backed by the driver's
+// mock deployment, so we can check the sent commands without a mongo server.
+func runMock(t *testing.T, fn func(mt *mtest.T, coll *mgm.Collection)) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("mock", func(mt *mtest.T) {
+		fn(mt, mgm.NewCollection(mt.DB, mt.Coll.Name()))
+	})
+}
+
+// runDefaultMock runs the test callback with a default connection that is
+// backed by the driver's mock deployment.
+func runDefaultMock(t *testing.T, fn func(mt *mtest.T)) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("mock", func(mt *mtest.T) {
+		mgm.RegisterConnection(mgm.NewConnection(mgm.DefaultConnectionName, nil, mt.Client, "db"))
+		defer mgm.ResetDefaultConfig()
+
+		fn(mt)
+	})
+}
+
 func resetCollection() {
 	_, err := mgm.Coll(&Doc{}).DeleteMany(bson.M{})
 	_, err2 := mgm.Coll(&Person{}).DeleteMany(bson.M{})
@@ -2,42 +2,141 @@ package mgm
 
 import (
 	"context"
+	"errors"
 
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrTxAttemptsExceeded is returned when a transaction's commit keeps failing
+// with transient errors after the transaction's max attempts.
+var ErrTxAttemptsExceeded = errors.New("transaction attempts exceeded")
+
+// errStopRetrying stops the retries of a transaction that reached its max attempts.
+var errStopRetrying = errors.New("stop retrying the transaction")
+
 // TransactionFunc is a handler to manage a transaction.
+// The transaction is committed when the handler returns without an
+// error, so there is no need to commit it in the handler.
 type TransactionFunc func(session mongo.Session, sc mongo.SessionContext) error
 
+// TxFunc is a transaction function. Pass its context to the collections'
+// WithCtx methods to run them in the transaction.
+type TxFunc func(ctx context.Context) error
+
+// TxOptions are the options of a transaction.
+type TxOptions struct {
+	// TransactionOptions are the driver options of the transaction, e.g its
+	// read concern, write concern, read preference and max commit time.
+	TransactionOptions *options.TransactionOptions
+	// MaxAttempts is the number of times the transaction runs when it fails with
+	// a transient transaction error. Zero retries until the driver's timeout (120s).
+	MaxAttempts int
+}
+
 // Transaction creates a transaction with the default client.
-func Transaction(f TransactionFunc) error {
+func Transaction(f TransactionFunc, opts ...*TxOptions) error {
 	ctx, cancel := ctx()
 	defer cancel()
 
-	return TransactionWithClient(ctx, client, f)
+	return TransactionWithClient(ctx, defaultConnection().client, f, opts...)
 }
 
 // TransactionWithCtx creates a transaction with the given context and the default client.
-func TransactionWithCtx(ctx context.Context, f TransactionFunc) error {
-	return TransactionWithClient(ctx, client, f)
+func TransactionWithCtx(ctx context.Context, f TransactionFunc, opts ...*TxOptions) error {
+	return TransactionWithClient(ctx, defaultConnection().client, f, opts...)
 }
 
 // TransactionWithClient creates a transaction with the given client.
-func TransactionWithClient(ctx context.Context, client *mongo.Client, f TransactionFunc) error {
-	session, err := client.StartSession() //start session need to get options.
-	if err != nil {
-		return err
+// See WithTransaction for the transaction's retries and nested calls.
+func TransactionWithClient(ctx context.Context, client *mongo.Client, f TransactionFunc, opts ...*TxOptions) error {
+	return withTransaction(ctx, client, func(ctx context.Context) error {
+		session := mongo.SessionFromContext(ctx)
+		return f(session, mongo.NewSessionContext(ctx, session))
+	}, opts)
+}
+
+// WithTransaction runs the function in a transaction of the default connection. The
+// transaction is committed when the function returns without an error, otherwise
+// it's aborted. The function is retried when the transaction fails with a transient
+// transaction error, so it should not have side effects outside of the database.
+//
+// If the context carries a running transaction (e.g a nested call), the function runs
+// in that transaction. If it carries a session, the transaction uses that session.
+func WithTransaction(ctx context.Context, f TxFunc, opts ...*TxOptions) error {
+	return withTransaction(ctx, defaultConnection().client, f, opts)
+}
+
+func withTransaction(ctx context.Context, client *mongo.Client, f TxFunc, opts []*TxOptions) error {
+	session := mongo.SessionFromContext(ctx)
+
+	if session == nil {
+		var err error
+		if session, err = client.StartSession(); err != nil {
+			return err
+		}
+
+		defer session.EndSession(ctx)
+	} else if inTransaction(session) {
+		return f(ctx)
 	}
 
-	defer session.EndSession(ctx)
+	o := mergeTxOptions(opts)
+	attempts := 0
+	var lastErr error
+
+	_, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		if o.MaxAttempts > 0 && attempts >= o.MaxAttempts {
+			// The commit of the last attempt failed with a transient error.
+			return nil, ErrTxAttemptsExceeded
+		}
+		attempts++
+
+		err := func() error {
+			defer trackTransaction(session.Client())()
+			return f(sc)
+		}()
+
+		if err != nil && o.MaxAttempts > 0 && attempts >= o.MaxAttempts {
+			lastErr = err
+			return nil, errStopRetrying
+		}
+
+		return nil, err
+	}, o.TransactionOptions)
+
+	if errors.Is(err, errStopRetrying) {
+		return lastErr
+	}
+
+	return err
+}
+
+// inTransaction returns true if the session has a running transaction.
+func inTransaction(session mongo.Session) bool {
+	xs, ok := session.(mongo.XSession)
+
+	return ok && xs.ClientSession().TransactionRunning()
+}
+
+func mergeTxOptions(opts []*TxOptions) TxOptions {
+	o := TxOptions{}
 
-	if err = session.StartTransaction(); err != nil { // startTransaction need to get options.
-		return err
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.TransactionOptions != nil {
+			o.TransactionOptions = opt.TransactionOptions
+		}
+		if opt.MaxAttempts != 0 {
+			o.MaxAttempts = opt.MaxAttempts
+		}
 	}
 
-	wrapperFn := func(sc mongo.SessionContext) error {
-		return f(session, sc)
+	if o.TransactionOptions == nil {
+		o.TransactionOptions = options.Transaction()
 	}
 
-	return mongo.WithSession(ctx, session, wrapperFn)
+	return o
 }
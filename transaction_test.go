@@ -1,6 +1,8 @@
 package mgm_test
 
 import (
+	"context"
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -8,6 +10,9 @@ import (
 	"github.com/uncle-gua/mgm/internal/util"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 )
 
 // Note: to run Transaction tests, the MongoDB daemon must run as replica set, not as a standalone daemon.
@@ -88,3 +93,108 @@ func TestTransactionWithCtx(t *testing.T) {
 	util.AssertErrIsNil(t, err)
 	require.Equal(t, int64(0), count)
 }
+
+func transientError() bson.D {
+	return mtest.CreateCommandErrorResponse(mtest.CommandError{
+		Code:    112,
+		Name:    "WriteConflict",
+		Message: "write conflict",
+		Labels:  []string{"TransientTransactionError"},
+	})
+}
+
+func TestWithTransactionRetriesTransientErrors(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		mt.AddMockResponses(transientError(), mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+
+		attempts := 0
+		err := mgm.WithTransaction(context.Background(), func(ctx context.Context) error {
+			attempts++
+			return mgm.Coll(&Doc{}).CreateWithCtx(ctx, NewDoc("Ali", 24))
+		})
+		util.AssertErrIsNil(t, err)
+		require.Equal(t, 2, attempts)
+
+		var commands []string
+		for evt := mt.GetStartedEvent(); evt != nil; evt = mt.GetStartedEvent() {
+			commands = append(commands, evt.CommandName)
+		}
+		require.Equal(t, []string{"insert", "abortTransaction", "insert", "commitTransaction"}, commands)
+	})
+}
+
+func TestWithTransactionMaxAttempts(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		mt.AddMockResponses(transientError(), mtest.CreateSuccessResponse())
+
+		attempts := 0
+		err := mgm.WithTransaction(context.Background(), func(ctx context.Context) error {
+			attempts++
+			return mgm.Coll(&Doc{}).CreateWithCtx(ctx, NewDoc("Ali", 24))
+		}, &mgm.TxOptions{MaxAttempts: 1})
+
+		var cmdErr mongo.CommandError
+		require.True(t, errors.As(err, &cmdErr))
+		require.True(t, cmdErr.HasErrorLabel("TransientTransactionError"))
+		require.Equal(t, 1, attempts)
+	})
+}
+
+func TestWithTransactionOptions(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+
+		opts := &mgm.TxOptions{TransactionOptions: options.Transaction().SetWriteConcern(writeconcern.New(writeconcern.WMajority()))}
+		err := mgm.WithTransaction(context.Background(), func(ctx context.Context) error {
+			return mgm.Coll(&Doc{}).CreateWithCtx(ctx, NewDoc("Ali", 24))
+		}, opts)
+		util.AssertErrIsNil(t, err)
+
+		mt.GetStartedEvent()
+		commit := mt.GetStartedEvent()
+		require.Equal(t, "commitTransaction", commit.CommandName)
+		require.Equal(t, "majority", commit.Command.Lookup("writeConcern", "w").StringValue())
+	})
+}
+
+func TestWithTransactionNested(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+
+		err := mgm.WithTransaction(context.Background(), func(ctx context.Context) error {
+			if err := mgm.Coll(&Doc{}).CreateWithCtx(ctx, NewDoc("Ali", 24)); err != nil {
+				return err
+			}
+
+			return mgm.WithTransaction(ctx, func(ctx context.Context) error {
+				return mgm.Coll(&Doc{}).CreateWithCtx(ctx, NewDoc("Mehran", 24))
+			})
+		})
+		util.AssertErrIsNil(t, err)
+
+		outer, inner := mt.GetStartedEvent(), mt.GetStartedEvent()
+		require.Equal(t, outer.Command.Lookup("lsid"), inner.Command.Lookup("lsid"))
+		require.Equal(t, outer.Command.Lookup("txnNumber"), inner.Command.Lookup("txnNumber"))
+		require.Equal(t, "commitTransaction", mt.GetStartedEvent().CommandName)
+		require.Nil(t, mt.GetStartedEvent())
+	})
+}
+
+func TestWithTransactionReusesSession(t *testing.T) {
+	runDefaultMock(t, func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+
+		session, err := mt.Client.StartSession()
+		util.AssertErrIsNil(t, err)
+		defer session.EndSession(context.Background())
+
+		ctx := mongo.NewSessionContext(context.Background(), session)
+		err = mgm.WithTransaction(ctx, func(ctx context.Context) error {
+			return mgm.Coll(&Doc{}).CreateWithCtx(ctx, NewDoc("Ali", 24))
+		})
+		util.AssertErrIsNil(t, err)
+
+		lsid := mt.GetStartedEvent().Command.Lookup("lsid", "id")
+		require.Equal(t, session.ID().Lookup("id"), lsid)
+	})
+}
@@ -0,0 +1,150 @@
+package mgm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/uncle-gua/mgm/field"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TypedCollection performs operations on models of type T and returns
+// the decoded models instead of decoding them into a provided pointer.
+// T must be a pointer to a model struct (e.g *Book).
+type TypedCollection[T Model] struct {
+	coll *Collection
+}
+
+// TypedColl returns the typed collection associated with the model type T.
+// It panics if T is not a pointer to a struct.
+func TypedColl[T Model](opts ...*options.CollectionOptions) *TypedCollection[T] {
+	return NewTypedCollection[T](Coll(newModel[T](), opts...))
+}
+
+// NewTypedCollection returns a new typed collection on top of the provided collection.
+// It panics if T is not a pointer to a struct.
+func NewTypedCollection[T Model](coll *Collection) *TypedCollection[T] {
+	return &TypedCollection[T]{coll: coll.forModel(newModel[T]())}
+}
+
+// Collection returns the underlying untyped collection.
+func (tc *TypedCollection[T]) Collection() *Collection {
+	return tc.coll
+}
+
+// Name method returns the collection name.
+func (tc *TypedCollection[T]) Name() string {
+	return tc.coll.Name()
+}
+
+// WithTrashed returns a copy of the collection that includes soft-deleted models.
+func (tc *TypedCollection[T]) WithTrashed() *TypedCollection[T] {
+	return &TypedCollection[T]{coll: tc.coll.WithTrashed()}
+}
+
+// OnlyTrashed returns a copy of the collection that only sees soft-deleted models.
+func (tc *TypedCollection[T]) OnlyTrashed() *TypedCollection[T] {
+	return &TypedCollection[T]{coll: tc.coll.OnlyTrashed()}
+}
+
+// FindByID method finds a doc by its id and returns it as a model.
+// The id field can be any value that if passed to the `PrepareID` method, it returns
+// a valid ID (e.g string, bson.ObjectId).
+func (tc *TypedCollection[T]) FindByID(ctx context.Context, id interface{}, opts ...*options.FindOneOptions) (T, error) {
+	model := newModel[T]()
+
+	id, err := model.PrepareID(id)
+	if err != nil {
+		return zeroModel[T](), err
+	}
+
+	return tc.First(ctx, bson.M{field.ID: id}, opts...)
+}
+
+// First method searches and returns the first document in the search results.
+func (tc *TypedCollection[T]) First(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) (T, error) {
+	model := newModel[T]()
+
+	if err := first(ctx, tc.coll, filter, model, opts...); err != nil {
+		return zeroModel[T](), err
+	}
+
+	return model, nil
+}
+
+// AsOf returns the document with the given id as it was at the given time.
+// See Collection.AsOf.
+func (tc *TypedCollection[T]) AsOf(ctx context.Context, id interface{}, t time.Time) (T, error) {
+	model := newModel[T]()
+
+	if err := tc.coll.AsOf(ctx, id, t, model); err != nil {
+		return zeroModel[T](), err
+	}
+
+	return model, nil
+}
+
+// Find finds, decodes and returns the models matching the filter.
+func (tc *TypedCollection[T]) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) ([]T, error) {
+	results := make([]T, 0)
+
+	if err := tc.coll.SimpleFindWithCtx(ctx, &results, filter, opts...); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// Aggregate performs a simple aggregation and returns the decoded models.
+// The value of `stages` can be Operator|bson.M
+func (tc *TypedCollection[T]) Aggregate(ctx context.Context, stages ...interface{}) ([]T, error) {
+	results := make([]T, 0)
+
+	if err := tc.coll.SimpleAggregateWithCtx(ctx, &results, stages...); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// Count returns the number of documents matching the filter.
+func (tc *TypedCollection[T]) Count(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error) {
+	return tc.coll.CountDocumentsWithCtx(ctx, filter, opts...)
+}
+
+// Create method inserts a new model into the database.
+func (tc *TypedCollection[T]) Create(ctx context.Context, model T, opts ...*options.InsertOneOptions) error {
+	return create(ctx, tc.coll, model, opts...)
+}
+
+// Update function persists the changes made to a model to the database.
+// Calling this method also invokes the model's mgm updating, updated,
+// saving, and saved hooks.
+func (tc *TypedCollection[T]) Update(ctx context.Context, model T, opts ...*options.UpdateOptions) error {
+	return update(ctx, tc.coll, model, opts...)
+}
+
+// Delete method deletes a model (doc) from the collection.
+func (tc *TypedCollection[T]) Delete(ctx context.Context, model T) error {
+	return del(ctx, tc.coll, model)
+}
+
+// newModel returns a new instance of the model type T.
+// newModel returns a new model of type T. It panics if T is not a pointer to a
+// struct (e.g an interface), so typed collections of such types can't be created.
+func newModel[T Model]() T {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("mgm: the model type of a typed collection must be a pointer to a struct, got %s", t))
+	}
+
+	return reflect.New(t.Elem()).Interface().(T)
+}
+
+func zeroModel[T Model]() T {
+	var zero T
+	return zero
+}
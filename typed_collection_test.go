@@ -0,0 +1,84 @@
+package mgm_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uncle-gua/mgm"
+	"github.com/uncle-gua/mgm/internal/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestTypedCollection_FindByID(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch,
+			bson.D{{Key: "_id", Value: id}, {Key: "name", Value: "Ali"}, {Key: "age", Value: 24}}))
+
+		doc, err := mgm.NewTypedCollection[*Doc](coll).FindByID(context.Background(), id.Hex())
+		util.AssertErrIsNil(t, err)
+
+		require.Equal(t, id, doc.ID)
+		require.Equal(t, "Ali", doc.Name)
+		require.Equal(t, 24, doc.Age)
+	})
+}
+
+func TestTypedCollection_FindByInvalidID(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		doc, err := mgm.NewTypedCollection[*Doc](coll).FindByID(context.Background(), "invalid id")
+
+		require.Error(t, err)
+		require.Nil(t, doc)
+	})
+}
+
+func TestTypedCollection_Find(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.coll", mtest.FirstBatch,
+			bson.D{{Key: "name", Value: "Ali"}},
+			bson.D{{Key: "name", Value: "Reza"}},
+		))
+
+		docs, err := mgm.NewTypedCollection[*Doc](coll).Find(context.Background(), bson.M{})
+		util.AssertErrIsNil(t, err)
+
+		require.Len(t, docs, 2)
+		require.Equal(t, "Ali", docs[0].Name)
+		require.Equal(t, "Reza", docs[1].Name)
+	})
+}
+
+func TestTypedCollection_CreateCallsHooks(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		person := NewPerson("Ali", 24)
+		person.On("Creating").Return(nil)
+		person.On("Created").Return(nil)
+		person.On("Saving").Return(nil)
+		person.On("Saved").Return(nil)
+
+		util.AssertErrIsNil(t, mgm.NewTypedCollection[*Person](coll).Create(context.Background(), person))
+
+		person.AssertExpectations(t)
+		require.NotEqual(t, primitive.NilObjectID, person.ID)
+	})
+}
+
+func TestTypedCollName(t *testing.T) {
+	setupDefConnection()
+
+	require.Equal(t, mgm.CollName(&Doc{}), mgm.TypedColl[*Doc]().Name())
+}
+
+func TestTypedCollectionOfInterface(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		require.PanicsWithValue(t, "mgm: the model type of a typed collection must be a pointer to a struct, got mgm.Model", func() {
+			mgm.NewTypedCollection[mgm.Model](coll)
+		})
+	})
+}
@@ -0,0 +1,117 @@
+package mgm
+
+import (
+	"context"
+
+	"github.com/uncle-gua/mgm/builder"
+	"github.com/uncle-gua/mgm/field"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UpdateOneWhere updates the first document matching the filter using the update builder.
+// Note: this method does not call any model hooks.
+func (coll *Collection) UpdateOneWhere(ctx context.Context, filter interface{}, upd *builder.UpdateBuilder, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	return updateOne(ctx, coll, nil, coll.scopeFilter(filter), upd.ToMap(), withArrayFilters(upd, opts))
+}
+
+// UpdateManyWhere updates all documents matching the filter using the update builder.
+// Note: this method does not call any model hooks.
+func (coll *Collection) UpdateManyWhere(ctx context.Context, filter interface{}, upd *builder.UpdateBuilder, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	return updateMany(ctx, coll, coll.scopeFilter(filter), upd.ToMap(), withArrayFilters(upd, opts))
+}
+
+// ApplyUpdate applies the update builder to the model's document.
+// Calling this method also invokes the model's mgm updating and updated hooks.
+// Note: the model's fields are not refreshed from the updated document. The updates of
+// auditable and revisioned models are recorded by reading the document before and after it.
+func (coll *Collection) ApplyUpdate(model Model, upd *builder.UpdateBuilder, opts ...*options.UpdateOptions) error {
+	ctx, cancel := coll.ctx()
+	defer cancel()
+
+	return coll.ApplyUpdateWithCtx(ctx, model, upd, opts...)
+}
+
+// ApplyUpdateWithCtx applies the update builder to the model's document using the specified context.
+// Calling this method also invokes the model's mgm updating and updated hooks.
+// Note: the model's fields are not refreshed from the updated document. The updates of
+// auditable and revisioned models are recorded by reading the document before and after it.
+func (coll *Collection) ApplyUpdateWithCtx(ctx context.Context, model Model, upd *builder.UpdateBuilder, opts ...*options.UpdateOptions) error {
+	if err := callToUpdatingHooks(ctx, model); err != nil {
+		return err
+	}
+
+	filter := bson.M{field.ID: model.GetID()}
+	doc := upd.ToMap()
+
+	// The update is applied by the server, so the recorded documents are read.
+	var stored bson.Raw
+	if isRecorded(model) {
+		var err error
+		if stored, err = findDocument(ctx, coll, model, filter); err != nil {
+			return err
+		}
+	}
+
+	versioned, isVersioned := model.(Versioned)
+	var version int64
+
+	if isVersioned {
+		version = versioned.GetVersion()
+		filter[field.Version] = versionFilter(version)
+		doc = withVersionInc(doc)
+	}
+
+	res, err := updateOne(ctx, coll, model, filter, doc, withArrayFilters(upd, opts))
+	if err != nil {
+		return err
+	}
+
+	if isVersioned {
+		if res.MatchedCount == 0 && res.UpsertedCount == 0 {
+			return &VersionConflictError{ID: model.GetID(), Version: version}
+		}
+		versioned.SetVersion(version + 1)
+	}
+
+	if stored != nil && res.ModifiedCount != 0 {
+		after, err := findDocument(ctx, coll, model, bson.M{field.ID: model.GetID()})
+		if err != nil {
+			return err
+		}
+
+		if err := recordDocument(ctx, coll, model, AuditUpdate, stored, after); err != nil {
+			return err
+		}
+	}
+
+	return callToUpdatedHooks(ctx, res, model)
+}
+
+// withArrayFilters appends the update builder's array filters to the options.
+func withArrayFilters(upd *builder.UpdateBuilder, opts []*options.UpdateOptions) []*options.UpdateOptions {
+	if filters := upd.GetArrayFilters(); len(filters) != 0 {
+		opts = append(opts, options.Update().SetArrayFilters(options.ArrayFilters{Filters: filters}))
+	}
+
+	return opts
+}
+
+// withVersionInc returns a copy of the update document that increments the model's version.
+func withVersionInc(doc bson.M) bson.M {
+	res := bson.M{}
+	for k, v := range doc {
+		res[k] = v
+	}
+
+	inc := bson.M{field.Version: 1}
+	if m, ok := doc["$inc"].(bson.M); ok {
+		for k, v := range m {
+			inc[k] = v
+		}
+	}
+	res["$inc"] = inc
+
+	return res
+}
@@ -0,0 +1,80 @@
+package mgm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uncle-gua/mgm"
+	"github.com/uncle-gua/mgm/builder"
+	"github.com/uncle-gua/mgm/internal/util"
+	"github.com/uncle-gua/mgm/operator"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCollection_UpdateManyWhere(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(
+			bson.E{Key: "n", Value: 2},
+			bson.E{Key: "nModified", Value: 2},
+		))
+
+		upd := builder.Update().
+			Inc(builder.FilteredPositional("items", "elem", "qty"), -1).
+			ArrayFilters(bson.M{"elem.sku": "abc"})
+
+		res, err := coll.UpdateManyWhere(context.Background(), bson.M{"age": bson.M{operator.Gt: 20}}, upd)
+		util.AssertErrIsNil(t, err)
+		require.Equal(t, int64(2), res.ModifiedCount)
+
+		u := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		require.True(t, u.Lookup("multi").Boolean())
+		require.Equal(t, int64(-1), u.Lookup("u", "$inc", "items.$[elem].qty").AsInt64())
+		require.Equal(t, "abc", u.Lookup("arrayFilters").Array().Index(0).Value().Document().Lookup("elem.sku").StringValue())
+	})
+}
+
+func TestCollection_ApplyUpdateCallsHooks(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(
+			bson.E{Key: "n", Value: 1},
+			bson.E{Key: "nModified", Value: 1},
+		))
+
+		person := NewPerson("Ali", 24)
+		person.On("Updating").Return(nil)
+		person.On("Updated", int64(1), int64(1)).Return(nil)
+
+		util.AssertErrIsNil(t, coll.ApplyUpdateWithCtx(context.Background(), person, builder.Update().Inc("age", 1)))
+		person.AssertExpectations(t)
+
+		u := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		require.Equal(t, int64(1), u.Lookup("u", "$inc", "age").AsInt64())
+	})
+}
+
+func TestCollection_ApplyUpdateVersioned(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}),
+		)
+
+		order := &Order{}
+		order.Version = 2
+
+		util.AssertErrIsNil(t, coll.ApplyUpdateWithCtx(context.Background(), order, builder.Update().Inc("total", 5)))
+		require.Equal(t, int64(3), order.Version)
+
+		u := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		require.Equal(t, int64(2), u.Lookup("q", "_v").AsInt64())
+		require.Equal(t, int64(1), u.Lookup("u", "$inc", "_v").AsInt64())
+		require.Equal(t, int64(5), u.Lookup("u", "$inc", "total").AsInt64())
+
+		err := coll.ApplyUpdateWithCtx(context.Background(), order, builder.Update().Inc("total", 5))
+		require.True(t, errors.Is(err, mgm.ErrVersionConflict))
+		require.Equal(t, int64(3), order.Version)
+	})
+}
@@ -8,14 +8,31 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// Coll returns the collection associated with a model.
+// Coll returns the collection associated with a model. The model's collection
+// belongs to the connection that the `ConnectionNameGetter` returns, if the model
+// implements this interface. Otherwise, it belongs to the default connection.
+// Like Use, it panics if the model's connection is not registered, so register
+// the connections before getting their models' collections.
 func Coll(m Model, opts ...*options.CollectionOptions) *Collection {
+	conn := defaultConnection()
+
+	if connNameGetter, ok := m.(ConnectionNameGetter); ok {
+		conn = Use(connNameGetter.ConnectionName())
+	}
+
+	return collOf(m, conn, opts...)
+}
+
+func collOf(m Model, conn *Connection, opts ...*options.CollectionOptions) *Collection {
+	var coll *Collection
 
 	if collGetter, ok := m.(CollectionGetter); ok {
-		return collGetter.Collection()
+		coll = collGetter.Collection()
+	} else {
+		coll = conn.CollectionByName(CollName(m), opts...)
 	}
 
-	return CollectionByName(CollName(m), opts...)
+	return coll.forModel(m)
 }
 
 // CollName returns a model's collection name. The `CollectionNameGetter` will be used
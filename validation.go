@@ -0,0 +1,189 @@
+package mgm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Validator is implemented by models that validate themselves in addition
+// to their fields' validation tags. Return ValidationErrors to report field
+// errors along with the tags' errors.
+type Validator interface {
+	Validate(context.Context) error
+}
+
+// ValidationError is the failure of a validation rule on a field.
+type ValidationError struct {
+	// Field is the field's dotted bson path, e.g "items.0.name".
+	Field string `json:"field"`
+	// Rule is the failed rule, e.g "min".
+	Rule string `json:"rule"`
+	// Param is the rule's parameter, e.g "3" for the `min=3` rule.
+	Param string      `json:"param,omitempty"`
+	Value interface{} `json:"value"`
+}
+
+func (e ValidationError) Error() string {
+	rule := e.Rule
+	if e.Param != "" {
+		rule += "=" + e.Param
+	}
+
+	return fmt.Sprintf("field %s failed the %s rule", e.Field, rule)
+}
+
+// ValidationErrors is returned by Create and Update when a model is not valid.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// validationRules are the `mgm` tag options that are validation rules
+// of non-zero values, in the order they're checked.
+var validationRules = []string{"min", "max", "email", "oneof"}
+
+var emailRegex = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+// validate validates the model's fields using their `mgm` tags, then
+// calls the model's Validator.
+func validate(ctx context.Context, model Model) error {
+	var errs ValidationErrors
+
+	v := reflect.ValueOf(model)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		validateStruct(v.Elem(), "", &errs)
+	}
+
+	if validator, ok := model.(Validator); ok {
+		if err := validator.Validate(ctx); err != nil {
+			var modelErrs ValidationErrors
+			if !errors.As(err, &modelErrs) {
+				return err
+			}
+			errs = append(errs, modelErrs...)
+		}
+	}
+
+	if len(errs) != 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func validateStruct(v reflect.Value, prefix string, errs *ValidationErrors) {
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	for _, f := range modelFields(v.Type()) {
+		fv, err := v.FieldByIndexErr(f.index)
+		if err != nil {
+			// A nil nested struct, so its fields are not set.
+			continue
+		}
+
+		path := prefix + f.path
+		validateField(fv, path, f.mgm, errs)
+
+		// Validate the structs in slices, the nested structs are
+		// validated using their dotted path.
+		fv = reflect.Indirect(fv)
+		if fv.Kind() != reflect.Slice && fv.Kind() != reflect.Array {
+			continue
+		}
+		if !isNestedStruct(indirectType(fv.Type().Elem())) {
+			continue
+		}
+		for i := 0; i < fv.Len(); i++ {
+			validateStruct(reflect.Indirect(fv.Index(i)), path+"."+strconv.Itoa(i)+".", errs)
+		}
+	}
+}
+
+// validateField checks the field's rules. Rules other than `required`
+// are not checked on zero values.
+func validateField(v reflect.Value, path string, tag tagOptions, errs *ValidationErrors) {
+	if v.IsZero() {
+		if tag.has("required") {
+			*errs = append(*errs, ValidationError{Field: path, Rule: "required", Value: v.Interface()})
+		}
+		return
+	}
+
+	value := v.Interface()
+	v = reflect.Indirect(v)
+
+	for _, rule := range validationRules {
+		param, ok := tag[rule]
+		if !ok {
+			continue
+		}
+
+		if !checkRule(rule, param, v) {
+			*errs = append(*errs, ValidationError{Field: path, Rule: rule, Param: param, Value: value})
+		}
+	}
+}
+
+func checkRule(rule, param string, v reflect.Value) bool {
+	switch rule {
+	case "min", "max":
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return false
+		}
+
+		size, ok := ruleSize(v)
+		if !ok {
+			return false
+		}
+
+		if rule == "min" {
+			return size >= limit
+		}
+		return size <= limit
+	case "email":
+		return v.Kind() == reflect.String && emailRegex.MatchString(v.String())
+	case "oneof":
+		s := fmt.Sprint(v.Interface())
+		for _, option := range strings.Fields(param) {
+			if s == option {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// ruleSize returns the value that the min and max rules compare: the
+// length of strings, slices and maps, or the value of numbers.
+func ruleSize(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(len([]rune(v.String()))), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+
+	return 0, false
+}
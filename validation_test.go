@@ -0,0 +1,103 @@
+package mgm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uncle-gua/mgm"
+	"github.com/uncle-gua/mgm/internal/util"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+type Address struct {
+	City string `bson:"city" mgm:"required"`
+}
+
+type LineItem struct {
+	SKU string `bson:"sku" mgm:"required,min=3"`
+	Qty int    `bson:"qty" mgm:"max=10"`
+}
+
+type Customer struct {
+	mgm.DefaultModel `bson:",inline"`
+
+	Name    string     `bson:"name" mgm:"required,min=3,max=50"`
+	Email   string     `bson:"email" mgm:"email"`
+	Plan    string     `bson:"plan" mgm:"oneof=free pro"`
+	Address *Address   `bson:"address"`
+	Items   []LineItem `bson:"items"`
+}
+
+func (c *Customer) Validate(ctx context.Context) error {
+	if c.Plan == "pro" && c.Email == "" {
+		return mgm.ValidationErrors{{Field: "email", Rule: "required_with_pro"}}
+	}
+	return nil
+}
+
+func validationRules(t *testing.T, err error) []string {
+	var errs mgm.ValidationErrors
+	require.True(t, errors.As(err, &errs), "expected validation errors, got %v", err)
+
+	var rules []string
+	for _, e := range errs {
+		rules = append(rules, e.Field+":"+e.Rule)
+	}
+	return rules
+}
+
+func TestValidationOnCreate(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		c := &Customer{
+			Name:    "Al",
+			Email:   "not-an-email",
+			Plan:    "gold",
+			Address: &Address{},
+			Items:   []LineItem{{SKU: "abc", Qty: 2}, {SKU: "x", Qty: 11}},
+		}
+
+		err := coll.CreateWithCtx(context.Background(), c)
+		require.Equal(t, []string{
+			"name:min",
+			"email:email",
+			"plan:oneof",
+			"address.city:required",
+			"items.1.sku:min",
+			"items.1.qty:max",
+		}, validationRules(t, err))
+
+		// Nothing is sent to the database.
+		require.Nil(t, mt.GetStartedEvent())
+	})
+}
+
+func TestValidationErrorDetails(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		err := coll.CreateWithCtx(context.Background(), &Customer{Name: "Al"})
+
+		var errs mgm.ValidationErrors
+		require.True(t, errors.As(err, &errs))
+		require.Equal(t, mgm.ValidationError{Field: "name", Rule: "min", Param: "3", Value: "Al"}, errs[0])
+		require.EqualError(t, err, "field name failed the min=3 rule")
+	})
+}
+
+func TestValidatorInterface(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		c := &Customer{Plan: "pro"}
+
+		err := coll.UpdateWithCtx(context.Background(), c)
+		require.Equal(t, []string{"name:required", "email:required_with_pro"}, validationRules(t, err))
+	})
+}
+
+func TestValidModelIsSaved(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		c := &Customer{Name: "Alice", Email: "alice@example.com", Plan: "free", Items: []LineItem{{SKU: "abc"}}}
+		util.AssertErrIsNil(t, coll.CreateWithCtx(context.Background(), c))
+	})
+}
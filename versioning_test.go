@@ -0,0 +1,72 @@
+package mgm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uncle-gua/mgm"
+	"github.com/uncle-gua/mgm/internal/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+type Order struct {
+	mgm.DefaultModel `bson:",inline"`
+	mgm.VersionField `bson:",inline"`
+
+	Total int `bson:"total"`
+}
+
+func TestVersionedUpdate(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(
+			bson.E{Key: "n", Value: 1},
+			bson.E{Key: "nModified", Value: 1},
+		))
+
+		order := &Order{Total: 10}
+		order.ID = primitive.NewObjectID()
+		order.Version = 3
+
+		util.AssertErrIsNil(t, coll.UpdateWithCtx(context.Background(), order))
+		require.Equal(t, int64(4), order.Version)
+
+		upd := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		require.Equal(t, int64(3), upd.Lookup("q", "_v").AsInt64())
+		require.Equal(t, int64(4), upd.Lookup("u", "$set", "_v").AsInt64())
+	})
+}
+
+func TestVersionedUpdateMatchesLegacyDocs(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+
+		order := &Order{}
+		util.AssertErrIsNil(t, coll.UpdateWithCtx(context.Background(), order))
+
+		upd := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		in := upd.Lookup("q", "_v", "$in").Array()
+		require.Equal(t, bson.TypeNull, in.Index(1).Value().Type)
+	})
+}
+
+func TestVersionedUpdateConflict(t *testing.T) {
+	runMock(t, func(mt *mtest.T, coll *mgm.Collection) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}))
+
+		order := &Order{}
+		order.Version = 7
+
+		err := coll.UpdateWithCtx(context.Background(), order)
+
+		require.True(t, errors.Is(err, mgm.ErrVersionConflict))
+
+		var conflict *mgm.VersionConflictError
+		require.True(t, errors.As(err, &conflict))
+		require.Equal(t, int64(7), conflict.Version)
+		require.Equal(t, int64(7), order.Version)
+	})
+}